@@ -0,0 +1,237 @@
+package nbsoup
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidName = errors.New("invalid tag name")
+
+// Q starts a query element matching any of names, or any element if no name
+// is given. The methods below add to the element and return it, the
+// combinator methods link copies of both chains and return the last element
+// of the new chain, so a query can be reused in several chains:
+//
+//	Q("div").Attr("class", Contains, "x").Child(Q("h1"))
+//
+// is the query `div[class*="x"] > h1`.
+func Q(names ...string) *Query {
+	return &Query{Names: names}
+}
+
+// Attr adds a predicate which is AND-ed with the predicates of the current
+// group.
+func (query *Query) Attr(name string, op Operator, value string) *Query {
+	q := Predicate{Attr: name, Operator: op, Value: value}
+	if op == Fuzzy {
+		q.Threshold = defaultThreshold
+	}
+	return query.addPredicate(q)
+}
+
+// Similar adds a ~~= predicate with its own threshold.
+func (query *Query) Similar(name, value string, threshold float64) *Query {
+	return query.addPredicate(Predicate{Attr: name, Operator: Fuzzy, Value: value, Threshold: threshold})
+}
+
+// Func adds a call of a function registered with RegisterFunc.
+func (query *Query) Func(name string, args ...string) *Query {
+	return query.addPredicate(Predicate{Attr: ":" + name, Args: args})
+}
+
+// NotFunc adds a negated call of a registered function.
+func (query *Query) NotFunc(name string, args ...string) *Query {
+	return query.addPredicate(Predicate{Attr: ":" + name, Args: args, Negate: true})
+}
+
+// Or starts a new group of predicates, the groups are OR-ed.
+func (query *Query) Or() *Query {
+	query.Predicates = append(query.Predicates, nil)
+	return query
+}
+
+func (query *Query) addPredicate(q Predicate) *Query {
+	if len(query.Predicates) == 0 {
+		query.Predicates = append(query.Predicates, nil)
+	}
+	i := len(query.Predicates) - 1
+	query.Predicates[i] = append(query.Predicates[i], q)
+	return query
+}
+
+func (query *Query) First() *Query            { return query.addPseudo("first", 0, nil) }
+func (query *Query) Last() *Query             { return query.addPseudo("last", 0, nil) }
+func (query *Query) Odd() *Query              { return query.addPseudo("odd", 0, nil) }
+func (query *Query) Even() *Query             { return query.addPseudo("even", 0, nil) }
+func (query *Query) Nth(i int) *Query         { return query.addPseudo("nth", i, nil) }
+func (query *Query) NthOfType(i int) *Query   { return query.addPseudo("nth-of-type", i, nil) }
+func (query *Query) Has(sub ...*Query) *Query { return query.addPseudo("has", 0, sub) }
+
+func (query *Query) HasAncestor(sub ...*Query) *Query {
+	return query.addPseudo("has-ancestor", 0, sub)
+}
+
+func (query *Query) HasSibling(sub ...*Query) *Query {
+	return query.addPseudo("has-sibling", 0, sub)
+}
+
+func (query *Query) addPseudo(name string, arg int, sub []*Query) *Query {
+	p := Pseudo{Name: name, Arg: arg}
+	for _, s := range sub {
+		p.sub = append(p.sub, s.last().clone())
+	}
+	query.Pseudos = append(query.Pseudos, p)
+	return query
+}
+
+func (query *Query) Descendant(next *Query) *Query { return query.join(Descendant, next) }
+func (query *Query) Child(next *Query) *Query      { return query.join(Child, next) }
+func (query *Query) Adjacent(next *Query) *Query   { return query.join(Adjacent, next) }
+func (query *Query) Sibling(next *Query) *Query    { return query.join(Sibling, next) }
+
+func (query *Query) join(comb Combinator, next *Query) *Query {
+	last, tail := query.last().clone(), next.last().clone()
+	head := tail.first()
+	head.Combinator = comb
+	last.Next, head.Prev = head, last
+	return tail
+}
+
+// clone copies the chain ending at query and returns the copy of query.
+func (query *Query) clone() *Query {
+	var prev *Query
+	for q := query.first(); ; q = q.Next {
+		c := *q
+		c.Names = slices.Clone(q.Names)
+		c.Predicates = slices.Clone(q.Predicates)
+		for i := range c.Predicates {
+			c.Predicates[i] = slices.Clone(c.Predicates[i])
+		}
+		c.Pseudos = slices.Clone(q.Pseudos)
+		c.Prev, c.Next = prev, nil
+		if prev != nil {
+			prev.Next = &c
+		}
+		if q == query {
+			return &c
+		}
+		prev = &c
+	}
+}
+
+// Project sets the value FindValues returns for the chain, an attribute name
+// or one of "@content", "@text", "@owntext", "@html" and "@name".
+func (query *Query) Project(attr string) *Query {
+	query.last().Projection = attr
+	return query
+}
+
+// Sub returns the queries given to a :has, :has-ancestor or :has-sibling
+// pseudo-class, each as the last element of its chain.
+func (p Pseudo) Sub() []*Query {
+	return p.sub
+}
+
+// String prints the whole chain query belongs to in canonical form, parsing
+// the result gives the same query again.
+func (query *Query) String() string {
+	return query.last().chainString()
+}
+
+// NewSelector checks and compiles copies of queries built with Q. Each query
+// may be any element of its chain.
+func NewSelector(queries ...*Query) (*Selector, error) {
+	if len(queries) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	u := make(union, 0, len(queries))
+	for _, query := range queries {
+		last := query.last().clone()
+		if err := last.check(); err != nil {
+			return nil, err
+		}
+		u = append(u, last)
+	}
+	return &Selector{source: u.String(), union: u}, nil
+}
+
+// Queries returns the queries of the union, each as the last element of its
+// chain.
+func (s *Selector) Queries() []*Query {
+	return s.union
+}
+
+func (last *Query) check() error {
+	first := last.first()
+	if first.Combinator == Adjacent || first.Combinator == Sibling {
+		return ErrInvalidCombinator
+	}
+	if p := last.Projection; p != "" && !nameCheckRe.MatchString(p) && !isProjectionFunc(p) {
+		return ErrInvalidProjection
+	}
+	for query := first; query != nil; query = query.Next {
+		if _, ok := combinatorNames[query.Combinator]; !ok {
+			return ErrInvalidCombinator
+		}
+		if query != last && query.Projection != "" {
+			return ErrInvalidProjection
+		}
+		for _, name := range query.Names {
+			if name == "" || strings.IndexFunc(name, func(r rune) bool { return !isIdentRune(r) && r != '*' }) >= 0 {
+				return ErrInvalidName
+			}
+		}
+		for i, qList := range query.Predicates {
+			if len(qList) == 0 {
+				return ErrNoValidQuery
+			}
+			for j := range qList {
+				if err := query.Predicates[i][j].compile(); err != nil {
+					return err
+				}
+			}
+		}
+		for _, p := range query.Pseudos {
+			if err := p.check(); err != nil {
+				return err
+			}
+		}
+		if query == last {
+			break
+		}
+	}
+	return nil
+}
+
+func (p Pseudo) check() error {
+	argType, ok := pseudoArgs[p.Name]
+	switch {
+	case !ok:
+		return ErrInvalidPseudoClass
+	case argType == intArg && p.Arg == 0:
+		return ErrInvalidPseudoClass
+	case argType != queryArg:
+		return nil
+	case len(p.sub) == 0:
+		return ErrEmptyQuery
+	}
+	for _, sub := range p.sub {
+		if sub.Projection != "" {
+			return ErrInvalidProjection
+		}
+		if err := sub.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isProjectionFunc(attr string) bool {
+	for _, pseudo := range projectionFuncs {
+		if pseudo == attr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package nbsoup
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := Q("div").Attr("id", Equal, "app").Child(Q("ul")).Child(Q("li").Attr("class", Contains, `x"y`).Or().Attr("@content", Equal, "three"))
+	want := `div[id="app"] > ul > li[class*="x\"y" | @content="three"]`
+	if s := query.String(); s != want {
+		t.Fatalf("got %s, want %s", s, want)
+	}
+	sel, err := NewSelector(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(sel.FindAll(root)); len(got) != 1 || got[0] != "li:three" {
+		t.Fatalf("got %q", got)
+	}
+	sel, err = NewSelector(Q("p").Has(Q("span")).Project("@text"), Q("li").Nth(-1).Project("@content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := sel.FindValues(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0] != "three" || values[1] != "para inner" {
+		t.Fatalf("got %q", values)
+	}
+	if _, err := NewSelector(Q("li").Attr("class", Regexp, "(")); err == nil {
+		t.Fatal("want regexp error")
+	}
+	if _, err := NewSelector(Q("li").Or()); !errors.Is(err, ErrNoValidQuery) {
+		t.Fatalf("got %v", err)
+	}
+	if _, err := NewSelector(Q("li[")); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestQueryBuilderReuse(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Q("p")
+	direct := Q("div").Attr("id", Equal, "app").Child(p)
+	nested := Q("div").Attr("class", Equal, "nested").Descendant(p)
+	has := Q("div").Has(p)
+	p.Attr("class", Equal, "missing")
+	if s := p.String(); s != `p[class="missing"]` {
+		t.Fatalf("got %s", s)
+	}
+	for query, want := range map[*Query][]string{
+		direct: {`div[id="app"] > p`, "p:para inner"},
+		nested: {`div[class="nested"] p`, "p:deep"},
+		has:    {`div:has(p)`, "div:one two three para inner deep", "div:deep"},
+	} {
+		if s := query.String(); s != want[0] {
+			t.Errorf("got %s, want %s", s, want[0])
+		}
+		sel, err := NewSelector(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query.Attr("id", Equal, "missing")
+		if got := names(sel.FindAll(root)); strings.Join(got, ",") != strings.Join(want[1:], ",") {
+			t.Errorf("%s: got %q, want %q", want[0], got, want[1:])
+		}
+	}
+}
+
+func TestQueryRoundTrip(t *testing.T) {
+	registerFunc(t, "always", func(n *Node, args ...string) bool { return true })
+	list := []string{
+		`div`,
+		`> p`,
+		`div.p`,
+		`div[id="app"]..p + span ~ a`,
+		`td|th[@content*="a" & class!="b" | id%=r"\d+"]:first:nth(-2)`,
+		`a[title="say \"hi\"" & href%="\\d"]`,
+		`li[@content~~="one" 0.5 | @content~~="two"]`,
+		`li[price<>"1..2,5" & date>="2020-01-01"]`,
+		`div:has(p > span, a):has-ancestor(> body)`,
+		`div[!:always("a", "b\"c") & :always]`,
+		`a/@href, p/text()`,
+		`*[@attrs="x"]`,
+		`div.p`,
+		`  li[ a = 'x' ]`,
+	}
+	for _, s := range list {
+		sel, err := Compile(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		printed := sel.union.String()
+		if sel.String() != printed {
+			t.Fatalf("%s: %s != %s", s, sel.String(), printed)
+		}
+		again, err := Compile(printed)
+		if err != nil {
+			t.Fatalf("%s: %s: %v", s, printed, err)
+		}
+		if again.union.String() != printed {
+			t.Fatalf("%s: %s != %s", s, again.union.String(), printed)
+		}
+		built, err := NewSelector(sel.Queries()...)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if built.String() != printed {
+			t.Fatalf("%s: %s != %s", s, built.String(), printed)
+		}
+	}
+}
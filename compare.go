@@ -0,0 +1,158 @@
+package nbsoup
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidNumber = errors.New("value can not be converted to a number or date")
+var ErrInvalidRange = errors.New(`invalid range, want "min..max"`)
+
+type valueKind int
+
+const (
+	numberKind valueKind = iota
+	dateKind
+)
+
+var numberRe = regexp.MustCompile(`[-\x{2212}]?\d+(?:[.,'\x{00a0}\x{202f}]\d+)*`)
+var dateRe = regexp.MustCompile(`\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:\d{2})?)?`)
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func (q *Predicate) parseBounds() error {
+	if q.Operator != Between {
+		v, kind, err := parseLiteral(q.Value)
+		if err != nil {
+			return err
+		}
+		q.kind, q.min, q.max = kind, v, v
+		return nil
+	}
+	lo, hi, ok := strings.Cut(q.Value, "..")
+	if !ok {
+		return ErrInvalidRange
+	}
+	min, minKind, err := parseLiteral(lo)
+	if err != nil {
+		return err
+	}
+	max, maxKind, err := parseLiteral(hi)
+	if err != nil {
+		return err
+	}
+	if minKind != maxKind || min > max {
+		return ErrInvalidRange
+	}
+	q.kind, q.min, q.max = minKind, min, max
+	return nil
+}
+
+// parseLiteral reads a query value, which must be an ISO date or a number
+// with nothing around it but spaces and currency symbols.
+func parseLiteral(s string) (float64, valueKind, error) {
+	s = strings.TrimSpace(s)
+	if dateRe.FindString(s) == s {
+		if v, ok := parseDate(s); ok {
+			return v, dateKind, nil
+		}
+	}
+	m := strings.TrimFunc(s, func(r rune) bool { return unicode.IsSpace(r) || unicode.Is(unicode.Sc, r) })
+	if m != "" && numberRe.FindString(m) == m {
+		if v, ok := parseNumber(m); ok {
+			return v, numberKind, nil
+		}
+	}
+	return 0, numberKind, fmt.Errorf("%w: %q", ErrInvalidNumber, s)
+}
+
+// convert returns the first date or number in value, depending on the kind of
+// the query value.
+func (q Predicate) convert(value string) (float64, bool) {
+	if q.kind == dateKind {
+		return parseDate(dateRe.FindString(value))
+	}
+	return parseNumber(numberRe.FindString(value))
+}
+
+// compare never matches a value which can not be converted, Explanation.Why
+// tells such values apart from numbers or dates out of range.
+func (q Predicate) compare(value string) bool {
+	v, ok := q.convert(value)
+	if !ok {
+		return false
+	}
+	switch q.Operator {
+	case Less:
+		return v < q.max
+	case LessEqual:
+		return v <= q.max
+	case Greater:
+		return v > q.min
+	case GreaterEqual:
+		return v >= q.min
+	case Between:
+		return v >= q.min && v <= q.max
+	default:
+		return false
+	}
+}
+
+func parseDate(s string) (float64, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return float64(t.UnixNano()) / 1e9, true
+		}
+	}
+	return 0, false
+}
+
+// parseNumber accepts both "1,234.5" and "1.234,5" style numbers, the last
+// separator is the decimal mark when both appear. When only one kind appears
+// and repeats it groups thousands. A single dot is always the decimal mark, so
+// "1.234" is 1.234, and a single comma is the decimal mark unless exactly three
+// digits follow it, so "1,234" is 1234 and "1,5" is 1.5.
+func parseNumber(s string) (float64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	s = strings.Replace(s, "\u2212", "-", 1)
+	s = strings.NewReplacer("'", "", "\u00a0", "", "\u202f", "").Replace(s)
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma >= 0:
+		if dot > comma {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		}
+	case comma >= 0:
+		if strings.Count(s, ",") > 1 || len(s)-comma-1 == 3 {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+	case dot >= 0:
+		if strings.Count(s, ".") > 1 {
+			s = strings.ReplaceAll(s, ".", "")
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,496 @@
+package nbsoup
+
+import (
+	"hash/fnv"
+	"html"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ChangeKind int
+
+const (
+	Inserted ChangeKind = iota
+	Removed
+	Moved
+	AttrChanged
+	TextChanged
+)
+
+var changeKindNames = map[ChangeKind]string{
+	Inserted:    "inserted",
+	Removed:     "removed",
+	Moved:       "moved",
+	AttrChanged: "attribute changed",
+	TextChanged: "text changed",
+}
+
+func (k ChangeKind) String() string {
+	return changeKindNames[k]
+}
+
+// Change is a difference found by Diff. Old is the node in the first tree and
+// New the node in the second, Old is nil for Inserted and New for Removed.
+// Attr is the changed attribute of AttrChanged, OldValue and NewValue hold the
+// attribute values or the contents of TextChanged. A missing attribute has
+// an empty value.
+type Change struct {
+	Kind     ChangeKind
+	Old      *Node
+	New      *Node
+	Attr     string
+	OldValue string
+	NewValue string
+}
+
+// Edit costs of Diff. Renaming is never cheaper than removing and inserting,
+// so only nodes with the same name are paired.
+const (
+	indelCost  = 2
+	renameCost = 2*indelCost + 1
+)
+
+// postTree numbers the nodes of a tree in post-order from 1, lml holds the
+// leftmost leaf of every node. Subtrees found in both trees are collapsed into
+// one node weighing as much as all of their nodes.
+type postTree struct {
+	nodes    []*Node
+	lml      []int
+	weight   []int
+	keyroots []int
+	order    []*Node
+	pre      map[*Node]int
+	hash     map[*Node]uint64
+}
+
+func newPostTree(root *Node) *postTree {
+	t := &postTree{nodes: []*Node{nil}, lml: []int{0}, weight: []int{0}, pre: make(map[*Node]int), hash: make(map[*Node]uint64)}
+	var walk func(n *Node) uint64
+	walk = func(n *Node) uint64 {
+		t.pre[n] = len(t.order)
+		t.order = append(t.order, n)
+		var b strings.Builder
+		writeField(&b, n.Name)
+		for _, key := range sortedKeys(n.AttrMap) {
+			writeField(&b, key)
+			writeField(&b, n.AttrMap[key])
+		}
+		writeField(&b, strings.TrimSpace(n.Content))
+		for _, child := range n.Children {
+			b.WriteString(strconv.FormatUint(walk(child), 36) + ";")
+		}
+		h := fnv.New64a()
+		h.Write([]byte(b.String()))
+		t.hash[n] = h.Sum64()
+		return t.hash[n]
+	}
+	walk(root)
+	return t
+}
+
+// number lays out the tree in post-order, collapsing the subtrees with
+// children whose hash is in shared.
+func (t *postTree) number(root *Node, shared map[uint64]bool) {
+	var visit func(n *Node) int
+	visit = func(n *Node) int {
+		l := 0
+		weight := 1
+		if len(n.Children) > 0 && shared[t.hash[n]] {
+			weight = n.size()
+		} else {
+			for i, child := range n.Children {
+				if cl := visit(child); i == 0 {
+					l = cl
+				}
+			}
+		}
+		t.nodes = append(t.nodes, n)
+		t.weight = append(t.weight, weight)
+		if l == 0 {
+			l = len(t.nodes) - 1
+		}
+		t.lml = append(t.lml, l)
+		return l
+	}
+	visit(root)
+	seen := make(map[int]bool)
+	for i := len(t.nodes) - 1; i > 0; i-- {
+		if !seen[t.lml[i]] {
+			seen[t.lml[i]] = true
+			t.keyroots = append(t.keyroots, i)
+		}
+	}
+	sort.Ints(t.keyroots)
+}
+
+func (n *Node) size() int {
+	count := 1
+	for _, child := range n.Children {
+		count += child.size()
+	}
+	return count
+}
+
+// shares returns the hashes of the subtrees of t which are in o as well.
+func (t *postTree) shares(o *postTree) map[uint64]bool {
+	in := make(map[uint64]bool, len(o.hash))
+	for _, h := range o.hash {
+		in[h] = true
+	}
+	shared := make(map[uint64]bool)
+	for _, h := range t.hash {
+		if in[h] {
+			shared[h] = true
+		}
+	}
+	return shared
+}
+
+type differ struct {
+	a, b *postTree
+	td   [][]int
+}
+
+// Diff compares two trees with the Zhang-Shasha tree edit distance over
+// Name, AttrMap and Content and returns the changes turning a into b.
+// Removed nodes come first in the order of a, the other changes follow in
+// the order of b. A removed or inserted subtree is reported once. A node
+// kept under another parent, or a subtree removed in one place and inserted
+// unchanged in another, is Moved. Subtrees found unchanged in both trees are
+// compared as single nodes, so time and memory grow with the product of the
+// numbers of changed nodes.
+func Diff(a, b *Node) []Change {
+	d := &differ{a: newPostTree(a), b: newPostTree(b)}
+	shared := d.a.shares(d.b)
+	d.a.number(a, shared)
+	d.b.number(b, shared)
+	d.td = make([][]int, len(d.a.nodes))
+	for i := range d.td {
+		d.td[i] = make([]int, len(d.b.nodes))
+	}
+	for _, i := range d.a.keyroots {
+		for _, j := range d.b.keyroots {
+			d.forest(i, j)
+		}
+	}
+	return d.changes()
+}
+
+func (d *differ) removeCost(x int) int {
+	return d.a.weight[x] * indelCost
+}
+
+func (d *differ) insertCost(y int) int {
+	return d.b.weight[y] * indelCost
+}
+
+// relabelCost is the cost of pairing x and y. A collapsed subtree is only
+// paired with the same subtree.
+func (d *differ) relabelCost(x, y int) int {
+	a, b := d.a.nodes[x], d.b.nodes[y]
+	if d.a.weight[x] > 1 || d.b.weight[y] > 1 {
+		if d.a.weight[x] == d.b.weight[y] && d.a.hash[a] == d.b.hash[b] {
+			return 0
+		}
+		return d.removeCost(x) + d.insertCost(y) + 1
+	}
+	if a.Name != b.Name {
+		return renameCost
+	}
+	var cost int
+	if !maps.Equal(a.AttrMap, b.AttrMap) {
+		cost++
+	}
+	if strings.TrimSpace(a.Content) != strings.TrimSpace(b.Content) {
+		cost++
+	}
+	return cost
+}
+
+// forest computes the distances between the forests ending at x and y
+// within the subtrees i and j, fd[x-li+1][y-lj+1], and fills td for the pairs
+// of subtrees rooted at the start of both forests.
+func (d *differ) forest(i, j int) [][]int {
+	li, lj := d.a.lml[i], d.b.lml[j]
+	fd := make([][]int, i-li+2)
+	for x := range fd {
+		fd[x] = make([]int, j-lj+2)
+		if x > 0 {
+			fd[x][0] = fd[x-1][0] + d.removeCost(li+x-1)
+		}
+	}
+	for y := 1; y < len(fd[0]); y++ {
+		fd[0][y] = fd[0][y-1] + d.insertCost(lj+y-1)
+	}
+	for x := li; x <= i; x++ {
+		for y := lj; y <= j; y++ {
+			X, Y := x-li+1, y-lj+1
+			cost := min(fd[X-1][Y]+d.removeCost(x), fd[X][Y-1]+d.insertCost(y))
+			if d.a.lml[x] == li && d.b.lml[y] == lj {
+				fd[X][Y] = min(cost, fd[X-1][Y-1]+d.relabelCost(x, y))
+				d.td[x][y] = fd[X][Y]
+			} else {
+				fd[X][Y] = min(cost, fd[d.a.lml[x]-li][d.b.lml[y]-lj]+d.td[x][y])
+			}
+		}
+	}
+	return fd
+}
+
+// mapping walks the distance tables back and returns the paired nodes and
+// the nodes left unpaired in a and b, with the nodes of collapsed subtrees.
+func (d *differ) mapping() (pairs [][2]*Node, removed, inserted map[*Node]bool) {
+	removed, inserted = make(map[*Node]bool), make(map[*Node]bool)
+	stack := [][2]int{{len(d.a.nodes) - 1, len(d.b.nodes) - 1}}
+	for len(stack) > 0 {
+		i, j := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+		li, lj := d.a.lml[i], d.b.lml[j]
+		fd := d.forest(i, j)
+		x, y := i, j
+		for x >= li || y >= lj {
+			X, Y := x-li+1, y-lj+1
+			aligned := x >= li && y >= lj && d.a.lml[x] == li && d.b.lml[y] == lj
+			switch {
+			case aligned && fd[X-1][Y-1]+d.relabelCost(x, y) == fd[X][Y]:
+				pairs = pairSubtrees(pairs, d.a.nodes[x], d.b.nodes[y], d.a.weight[x] > 1)
+				x, y = x-1, y-1
+			case x >= li && y >= lj && !aligned && fd[d.a.lml[x]-li][d.b.lml[y]-lj]+d.td[x][y] == fd[X][Y]:
+				stack = append(stack, [2]int{x, y})
+				x, y = d.a.lml[x]-1, d.b.lml[y]-1
+			case x >= li && fd[X-1][Y]+d.removeCost(x) == fd[X][Y]:
+				markSubtree(removed, d.a.nodes[x], d.a.weight[x] > 1)
+				x--
+			default:
+				markSubtree(inserted, d.b.nodes[y], d.b.weight[y] > 1)
+				y--
+			}
+		}
+	}
+	return pairs, removed, inserted
+}
+
+// pairSubtrees pairs a with b, and all nodes under them if they are
+// collapsed.
+func pairSubtrees(pairs [][2]*Node, a, b *Node, collapsed bool) [][2]*Node {
+	pairs = append(pairs, [2]*Node{a, b})
+	if collapsed {
+		for i, child := range a.Children {
+			pairs = pairSubtrees(pairs, child, b.Children[i], true)
+		}
+	}
+	return pairs
+}
+
+func markSubtree(set map[*Node]bool, n *Node, collapsed bool) {
+	set[n] = true
+	if collapsed {
+		for _, child := range n.Children {
+			markSubtree(set, child, true)
+		}
+	}
+}
+
+// repair pairs an inserted node with a removed child of the node its parent
+// is paired with if they have the same name. The edit distance drops a
+// parent rather than its children when one of them moves away, which would
+// report an unchanged parent as removed and inserted.
+func (d *differ) repair(pairs [][2]*Node, removed, inserted map[*Node]bool) [][2]*Node {
+	oldOf := make(map[*Node]*Node, len(pairs))
+	for _, p := range pairs {
+		oldOf[p[1]] = p[0]
+	}
+	for _, n := range d.b.order {
+		parent := oldOf[n.Parent]
+		if !inserted[n] || parent == nil {
+			continue
+		}
+		var old *Node
+		for _, child := range parent.Children {
+			if removed[child] && child.Name == n.Name && (old == nil || d.a.hash[child] == d.b.hash[n]) {
+				old = child
+			}
+		}
+		if old == nil {
+			continue
+		}
+		delete(removed, old)
+		delete(inserted, n)
+		oldOf[n] = old
+		pairs = append(pairs, [2]*Node{old, n})
+	}
+	return pairs
+}
+
+func (d *differ) changes() []Change {
+	pairs, removed, inserted := d.mapping()
+	pairs = d.repair(pairs, removed, inserted)
+	var gone, added []*Node
+	for _, n := range d.a.order {
+		if removed[n] && !removed[n.Parent] {
+			gone = append(gone, n)
+		}
+	}
+	for _, n := range d.b.order {
+		if inserted[n] && !inserted[n.Parent] {
+			added = append(added, n)
+		}
+	}
+	var removals, changes []Change
+	used := make(map[*Node]bool)
+	for _, old := range gone {
+		key := outerHTML(old)
+		change := Change{Kind: Removed, Old: old}
+		for _, n := range added {
+			if !used[n] && outerHTML(n) == key {
+				used[n] = true
+				change = Change{Kind: Moved, Old: old, New: n}
+				break
+			}
+		}
+		if change.Kind == Moved {
+			changes = append(changes, change)
+		} else {
+			removals = append(removals, change)
+		}
+	}
+	for _, n := range added {
+		if !used[n] {
+			changes = append(changes, Change{Kind: Inserted, New: n})
+		}
+	}
+	pairOf := make(map[*Node]*Node, len(pairs))
+	for _, p := range pairs {
+		pairOf[p[0]] = p[1]
+	}
+	for _, p := range pairs {
+		old, n := p[0], p[1]
+		if old.Parent != nil && n.Parent != nil && pairOf[old.Parent] != n.Parent {
+			changes = append(changes, Change{Kind: Moved, Old: old, New: n})
+		}
+		keys := make([]string, 0, len(old.AttrMap)+len(n.AttrMap))
+		for k := range old.AttrMap {
+			keys = append(keys, k)
+		}
+		for k := range n.AttrMap {
+			if _, ok := old.AttrMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if old.AttrMap[k] != n.AttrMap[k] {
+				changes = append(changes, Change{AttrChanged, old, n, k, old.AttrMap[k], n.AttrMap[k]})
+			}
+		}
+		if strings.TrimSpace(old.Content) != strings.TrimSpace(n.Content) {
+			changes = append(changes, Change{Kind: TextChanged, Old: old, New: n, OldValue: old.Content, NewValue: n.Content})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return d.b.pre[changes[i].New] < d.b.pre[changes[j].New] })
+	return append(removals, changes...)
+}
+
+func outerHTML(n *Node) string {
+	var b strings.Builder
+	n.writeOuter(&b)
+	return b.String()
+}
+
+// FormatDiff renders changes like a unified diff. Every change starts with an
+// @@ line holding the path of the node, removed lines start with - and added
+// lines with +. Nodes moved out of a removed node or into an inserted one are
+// left out of its lines.
+func FormatDiff(changes []Change) string {
+	moved := make(map[*Node]bool)
+	for _, c := range changes {
+		if c.Kind == Moved {
+			moved[c.Old], moved[c.New] = true, true
+		}
+	}
+	var b strings.Builder
+	b.WriteString("--- a\n+++ b\n")
+	for _, c := range changes {
+		switch c.Kind {
+		case Removed:
+			b.WriteString("@@ -" + c.Old.path() + " @@\n")
+			writeLines(&b, "-", outerHTMLWithout(c.Old, moved))
+		case Inserted:
+			b.WriteString("@@ +" + c.New.path() + " @@\n")
+			writeLines(&b, "+", outerHTMLWithout(c.New, moved))
+		case Moved:
+			b.WriteString("@@ -" + c.Old.path() + " +" + c.New.path() + " @@ moved\n")
+			var tag strings.Builder
+			c.New.writeStartTag(&tag)
+			writeLines(&b, " ", tag.String())
+		case AttrChanged:
+			b.WriteString("@@ " + c.New.path() + " @@\n")
+			if _, ok := c.Old.AttrMap[c.Attr]; ok {
+				writeLines(&b, "-", c.Attr+"="+strconv.Quote(c.OldValue))
+			}
+			if _, ok := c.New.AttrMap[c.Attr]; ok {
+				writeLines(&b, "+", c.Attr+"="+strconv.Quote(c.NewValue))
+			}
+		case TextChanged:
+			b.WriteString("@@ " + c.New.path() + " @@\n")
+			writeLines(&b, "-", strings.TrimSpace(c.OldValue))
+			writeLines(&b, "+", strings.TrimSpace(c.NewValue))
+		}
+	}
+	return b.String()
+}
+
+// outerHTMLWithout renders n without the subtrees in skip.
+func outerHTMLWithout(n *Node, skip map[*Node]bool) string {
+	var b strings.Builder
+	var write func(n *Node)
+	write = func(n *Node) {
+		if skip[n] {
+			return
+		}
+		if n.Name != "" {
+			n.writeStartTag(&b)
+			if voidTags[n.Name] {
+				return
+			}
+		}
+		b.WriteString(html.EscapeString(n.Content))
+		for _, child := range n.Children {
+			write(child)
+		}
+		if n.Name != "" {
+			b.WriteString("</" + n.Name + ">")
+		}
+	}
+	write(n)
+	return b.String()
+}
+
+func writeLines(b *strings.Builder, prefix, s string) {
+	for _, line := range strings.Split(s, "\n") {
+		b.WriteString(prefix + line + "\n")
+	}
+}
+
+// path returns the position of n from its root like /html/body/div[2], the
+// index is only given for tags with siblings of the same name.
+func (n *Node) path() string {
+	var parts []string
+	for ; n.Parent != nil; n = n.Parent {
+		name := n.Name
+		if name == "" {
+			name = "node()"
+		} else if n.hasTypeSiblings() {
+			name += "[" + strconv.Itoa(n.typeIndex()) + "]"
+		}
+		parts = append(parts, name)
+	}
+	if len(parts) == 0 {
+		return "/"
+	}
+	slices.Reverse(parts)
+	return "/" + strings.Join(parts, "/")
+}
@@ -0,0 +1,97 @@
+package nbsoup
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := Parse([]byte(`<html><body><div id="app"><h1 class="t">Title</h1><ul><li>one</li><li>two</li></ul><p>old</p><span>gone</span></div><footer><a href="/x">x</a></footer></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Parse([]byte(`<html><body><div id="app"><h1 class="title">Title</h1><ul><li>one</li><li>two</li><li>three</li></ul><p>new</p></div><footer></footer><a href="/x">x</a></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := Diff(a, b)
+	got := make([]string, 0, len(changes))
+	for _, c := range changes {
+		s := c.Kind.String()
+		if c.Old != nil {
+			s += " " + c.Old.Name
+		}
+		if c.New != nil {
+			s += " " + c.New.Name
+		}
+		if c.Kind == AttrChanged || c.Kind == TextChanged {
+			s += fmt.Sprintf(" %s %q %q", c.Attr, c.OldValue, c.NewValue)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		`removed span`,
+		`attribute changed h1 h1 class "t" "title"`,
+		`inserted li`,
+		`text changed p p  "old" "new"`,
+		`moved a a`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	text := FormatDiff(changes)
+	for _, line := range []string{
+		"--- a\n+++ b\n",
+		"@@ -/html/body/div/span @@\n-<span>gone</span>\n",
+		"@@ /html/body/div/h1 @@\n-class=\"t\"\n+class=\"title\"\n",
+		"@@ +/html/body/div/ul/li[3] @@\n+<li>three</li>\n",
+		"@@ -/html/body/footer/a +/html/body/a @@ moved\n <a href=\"/x\">\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("missing %q in\n%s", line, text)
+		}
+	}
+	a, _ = Parse([]byte(`<div><footer><a href="/x">x</a></footer></div>`))
+	b, _ = Parse([]byte(`<div><section></section><a href="/x">x</a></div>`))
+	text = FormatDiff(Diff(a, b))
+	for _, line := range []string{
+		"@@ -/html/body/div/footer @@\n-<footer></footer>\n",
+		"@@ +/html/body/div/section @@\n+<section></section>\n",
+		"@@ -/html/body/div/footer/a +/html/body/div/a @@ moved\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("missing %q in\n%s", line, text)
+		}
+	}
+	data, err := os.ReadFile("test.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := Parse(data)
+	d, _ := Parse(data)
+	if changes := Diff(c, d); len(changes) != 0 {
+		t.Fatalf("got %d changes", len(changes))
+	}
+	td := MustCompile(`td`)
+	tds := td.FindAll(d)
+	tds[len(tds)/2].AttrMap["width"] = "1"
+	if changes := Diff(c, d); len(changes) != 1 || changes[0].Kind != AttrChanged || changes[0].Old != td.FindAll(c)[len(tds)/2] {
+		t.Fatalf("got %v", changes)
+	}
+}
+
+func BenchmarkDiff(b *testing.B) {
+	data, err := os.ReadFile("test.html")
+	if err != nil {
+		b.Fatal(err)
+	}
+	c, _ := Parse(data)
+	d, _ := Parse(data)
+	tds := MustCompile(`td`).FindAll(d)
+	tds[len(tds)/2].AttrMap["width"] = "1"
+	for i := 0; i < b.N; i++ {
+		Diff(c, d)
+	}
+}
@@ -0,0 +1,261 @@
+package nbsoup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explanation reports how a query was evaluated against a start node.
+type Explanation struct {
+	Chains []ChainReport
+	root   *Node
+	union  union
+}
+
+// ChainReport describes one query of a union. Steps are in query order,
+// Matched is the number of nodes the whole chain found.
+type ChainReport struct {
+	Query   string
+	Steps   []StepReport
+	Matched int
+}
+
+// StepReport describes one element of a chain. Candidates are the nodes
+// reached from the nodes passed by the previous step, the first step looks at
+// all descendants of the start node.
+type StepReport struct {
+	Query      string
+	Combinator string
+	Candidates int
+	Passed     int
+	Predicates []PredicateReport
+}
+
+// PredicateReport counts the candidates of a step passing a single predicate
+// on its own.
+type PredicateReport struct {
+	Predicate  string
+	Candidates int
+	Passed     int
+}
+
+type check struct {
+	text  string
+	match func(n *Node) bool
+}
+
+func Explain(node *Node, queryStr string) (*Explanation, error) {
+	u, err := parseUnion(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	e := &Explanation{root: node, union: u}
+	for _, last := range u {
+		e.Chains = append(e.Chains, explainChain(node, last))
+	}
+	return e, nil
+}
+
+func explainChain(root *Node, last *Query) ChainReport {
+	report := ChainReport{Query: last.chainString()}
+	passed := []*Node{root}
+	for query := last.first(); query != nil; query = query.Next {
+		candidates := reach(passed, query.Combinator)
+		step := StepReport{
+			Query:      query.elemString(),
+			Combinator: strings.Trim(combinatorNames[query.Combinator], " "),
+			Candidates: len(candidates),
+		}
+		for _, c := range queryChecks(query) {
+			pr := PredicateReport{Predicate: c.text, Candidates: len(candidates)}
+			for _, n := range candidates {
+				if c.match(n) {
+					pr.Passed++
+				}
+			}
+			step.Predicates = append(step.Predicates, pr)
+		}
+		passed = passed[:0:0]
+		for _, n := range candidates {
+			if n.matchQuery(query) {
+				passed = append(passed, n)
+			}
+		}
+		step.Passed = len(passed)
+		report.Steps = append(report.Steps, step)
+		if query == last {
+			break
+		}
+	}
+	report.Matched = len(passed)
+	return report
+}
+
+// reach returns the element nodes related to any node of from by comb.
+func reach(from []*Node, comb Combinator) []*Node {
+	seen := make(map[*Node]bool)
+	l := make([]*Node, 0, 64)
+	add := func(n *Node) {
+		if n.Name != "" && !seen[n] {
+			seen[n] = true
+			l = append(l, n)
+		}
+	}
+	var addDescendants func(n *Node)
+	addDescendants = func(n *Node) {
+		for _, child := range n.Children {
+			add(child)
+			addDescendants(child)
+		}
+	}
+	for _, n := range from {
+		switch comb {
+		case Child:
+			for _, child := range n.Children {
+				add(child)
+			}
+		case Adjacent:
+			if next := n.nextElement(); next != nil {
+				add(next)
+			}
+		case Sibling:
+			for next := n.nextElement(); next != nil; next = next.nextElement() {
+				add(next)
+			}
+		default:
+			addDescendants(n)
+		}
+	}
+	return l
+}
+
+func queryChecks(query *Query) []check {
+	checks := make([]check, 0, 8)
+	if len(query.Names) > 0 {
+		checks = append(checks, check{strings.Join(query.Names, "|"), func(n *Node) bool {
+			return query.matchName(n.Name)
+		}})
+	}
+	for _, qList := range query.Predicates {
+		for _, q := range qList {
+			checks = append(checks, check{q.String(), func(n *Node) bool {
+				return n.matchQ(q)
+			}})
+		}
+	}
+	for _, p := range query.Pseudos {
+		checks = append(checks, check{p.String(), func(n *Node) bool {
+			return n.matchPseudo(p)
+		}})
+	}
+	return checks
+}
+
+// Why lists the reasons n is not matched by the explained query, one entry
+// per query of the union. It returns nil if n is matched.
+func (e *Explanation) Why(n *Node) []string {
+	var reasons []string
+	for i, last := range e.union {
+		reason := e.reject(n, last)
+		if reason == "" {
+			return nil
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %s", e.Chains[i].Query, reason))
+	}
+	return reasons
+}
+
+func (e *Explanation) reject(n *Node, last *Query) string {
+	if !e.root.isAncestorOf(n) {
+		return "node is not inside the start node"
+	}
+	if n.matchChain(last, e.root) {
+		return ""
+	}
+	if n.matchQuery(last) {
+		relation := map[Combinator]string{
+			Descendant: "no ancestor",
+			Child:      "no parent",
+			Adjacent:   "no previous sibling",
+			Sibling:    "no previous sibling",
+		}[last.Combinator]
+		if last.Prev == nil {
+			return "parent is not the start node"
+		}
+		return fmt.Sprintf("%s matching %s", relation, last.Prev.chainString())
+	}
+	if n.Name == "" {
+		return "node is not an element"
+	}
+	failed := make([]string, 0, 4)
+	if len(last.Names) > 0 && !last.matchName(n.Name) {
+		failed = append(failed, strings.Join(last.Names, "|"))
+	}
+	if last.Predicates != nil && !n.matchQList(last.Predicates) {
+		for _, qList := range last.Predicates {
+			for _, q := range qList {
+				if !n.matchQ(q) {
+					failed = append(failed, q.String()+n.unconverted(q))
+				}
+			}
+		}
+	}
+	for _, p := range last.Pseudos {
+		if !n.matchPseudo(p) {
+			failed = append(failed, p.String())
+		}
+	}
+	return fmt.Sprintf("%s rejected by %s", last.elemString(), strings.Join(failed, ", "))
+}
+
+// unconverted explains a failed comparison whose node value holds no number
+// or date.
+func (n *Node) unconverted(q Predicate) string {
+	switch q.Operator {
+	case Less, LessEqual, Greater, GreaterEqual, Between:
+	default:
+		return ""
+	}
+	value, ok := n.attrValue(q.Attr)
+	if !ok {
+		return " (no value)"
+	}
+	if _, ok := q.convert(value); ok {
+		return ""
+	}
+	if q.kind == dateKind {
+		return " (no date in value)"
+	}
+	return " (no number in value)"
+}
+
+func (e *Explanation) String() string {
+	var b strings.Builder
+	for _, chain := range e.Chains {
+		fmt.Fprintf(&b, "%s: %d matched\n", chain.Query, chain.Matched)
+		for i, step := range chain.Steps {
+			fmt.Fprintf(&b, "  step %d %q %s: %d/%d passed\n", i+1, step.Combinator, step.Query, step.Passed, step.Candidates)
+			for _, p := range step.Predicates {
+				fmt.Fprintf(&b, "    %s: %d/%d passed\n", p.Predicate, p.Passed, p.Candidates)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (n *Node) isAncestorOf(node *Node) bool {
+	for p := node.Parent; p != nil; p = p.Parent {
+		if p == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Node) nextElement() *Node {
+	next := n.Next
+	for next != nil && next.Name == "" {
+		next = next.Next
+	}
+	return next
+}
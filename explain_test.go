@@ -0,0 +1,42 @@
+package nbsoup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := Explain(root, `div[id="app"] > p[@owntext="para" | @owntext="x"], ul > li[class="y"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Chains) != 2 {
+		t.Fatalf("got %d chains, want 2", len(e.Chains))
+	}
+	steps := e.Chains[0].Steps
+	if e.Chains[0].Matched != 1 || steps[0].Candidates != 12 || steps[0].Passed != 1 || steps[1].Candidates != 3 || steps[1].Passed != 1 {
+		t.Errorf("unexpected report:\n%s", e)
+	}
+	if p := steps[1].Predicates; len(p) != 3 || p[0].Predicate != "p" || p[0].Passed != 1 || p[1].Passed != 1 || p[2].Passed != 0 {
+		t.Errorf("unexpected predicates: %+v", p)
+	}
+	if s := e.Chains[1].Steps[1]; e.Chains[1].Matched != 0 || s.Candidates != 3 || s.Passed != 0 {
+		t.Errorf("unexpected report:\n%s", e)
+	}
+	ps, _ := root.FindAll(`p`)
+	if why := e.Why(ps[0]); why != nil {
+		t.Errorf("matched node rejected: %q", why)
+	}
+	why := e.Why(ps[1])
+	if len(why) != 2 || !strings.HasSuffix(why[0], `rejected by @owntext="para", @owntext="x"`) || !strings.HasSuffix(why[1], `rejected by li, class="y"`) {
+		t.Errorf("got %q", why)
+	}
+	e, _ = Explain(root, `div[class="nested"] > p`)
+	if why := e.Why(ps[0]); len(why) != 1 || !strings.HasSuffix(why[0], `no parent matching div[class="nested"]`) {
+		t.Errorf("got %q", why)
+	}
+}
@@ -0,0 +1,101 @@
+package nbsoup
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fingerprint hashes the tag names and attribute keys of n and all elements
+// under it. Attribute values, text and nodes without a name are left out, so
+// pages built from the same template share a fingerprint.
+func (n *Node) Fingerprint() uint64 {
+	return n.fingerprint(false)
+}
+
+// FingerprintText is the same as Fingerprint but also hashes the content of
+// the nodes with runs of spaces collapsed, to find duplicate records.
+func (n *Node) FingerprintText() uint64 {
+	return n.fingerprint(true)
+}
+
+func (n *Node) fingerprint(text bool) uint64 {
+	var b strings.Builder
+	n.writeShape(&b, text)
+	h := fnv.New64a()
+	h.Write([]byte(b.String()))
+	return h.Sum64()
+}
+
+// writeShape writes every name, key and text with its length in front, so
+// text looking like markup can not be taken for elements.
+func (n *Node) writeShape(b *strings.Builder, text bool) {
+	b.WriteString("(")
+	writeField(b, n.Name)
+	for _, key := range sortedKeys(n.AttrMap) {
+		writeField(b, key)
+	}
+	b.WriteString(";")
+	if text {
+		writeField(b, strings.Join(strings.Fields(n.Content), " "))
+	}
+	for _, child := range n.Children {
+		if child.Name != "" {
+			child.writeShape(b, text)
+		}
+	}
+	b.WriteString(")")
+}
+
+func writeField(b *strings.Builder, s string) {
+	b.WriteString(strconv.Itoa(len(s)) + ":" + s)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Similarity compares the shapes of the subtrees a and b between 0 and 1.
+// Every element is described by the tag names on its path from the subtree
+// root and its attribute keys, the score is the weighted Jaccard index of the
+// two multisets. Subtrees with the same Fingerprint score 1.
+func Similarity(a, b *Node) float64 {
+	sa, sb := a.shapes(), b.shapes()
+	var both, all int
+	for k, ca := range sa {
+		cb := sb[k]
+		both += min(ca, cb)
+		all += max(ca, cb)
+	}
+	for k, cb := range sb {
+		if _, ok := sa[k]; !ok {
+			all += cb
+		}
+	}
+	if all == 0 {
+		return 1
+	}
+	return float64(both) / float64(all)
+}
+
+func (n *Node) shapes() map[string]int {
+	m := make(map[string]int)
+	var visit func(n *Node, path string)
+	visit = func(n *Node, path string) {
+		path += "/" + n.Name
+		m[path+"["+strings.Join(sortedKeys(n.AttrMap), " ")+"]"]++
+		for _, child := range n.Children {
+			if child.Name != "" {
+				visit(child, path)
+			}
+		}
+	}
+	visit(n, "")
+	return m
+}
@@ -0,0 +1,44 @@
+package nbsoup
+
+import (
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	root, err := Parse([]byte(`<html><body>
+<div class="card"><h2>Alpha</h2><p class="price">10</p></div>
+<div class="card"><h2>Beta</h2><p class="price">20</p></div>
+<div class="card"><h2>Alpha</h2><p class="price">10</p></div>
+<div class="card"><h2>Gamma</h2><p class="price">30</p><p>sold out</p></div>
+<ul><li>x</li></ul>
+</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards, _ := root.FindAll(`div`)
+	if cards[0].Fingerprint() != cards[1].Fingerprint() || cards[0].Fingerprint() == cards[3].Fingerprint() {
+		t.Fatal("wrong structure fingerprints")
+	}
+	if cards[0].FingerprintText() == cards[1].FingerprintText() || cards[0].FingerprintText() != cards[2].FingerprintText() {
+		t.Fatal("wrong text fingerprints")
+	}
+	markup := &Node{Name: "div", Content: "<h2>Alpha</>"}
+	nested := &Node{Name: "div"}
+	nested.Children = []*Node{{Name: "h2", Content: "Alpha", Parent: nested}}
+	if markup.FingerprintText() == nested.FingerprintText() {
+		t.Fatal("text taken for markup")
+	}
+	joined := &Node{Name: "p", AttrMap: map[string]string{"a b": ""}}
+	split := &Node{Name: "p", AttrMap: map[string]string{"a": "", "b": ""}}
+	if joined.Fingerprint() == split.Fingerprint() {
+		t.Fatal("attribute keys run together")
+	}
+	ul, _ := root.FindFirst(`ul`)
+	if s := Similarity(cards[0], cards[1]); s != 1 {
+		t.Fatalf("got %v", s)
+	}
+	near, far := Similarity(cards[0], cards[3]), Similarity(cards[0], ul)
+	if near != 0.75 || far != 0 {
+		t.Fatalf("got %v, %v", near, far)
+	}
+}
@@ -0,0 +1,47 @@
+package nbsoup
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrUnknownFunc = errors.New("unknown function")
+var ErrInvalidFuncName = errors.New("invalid function name")
+var ErrNilFunc = errors.New("nil predicate function")
+
+// PredicateFunc decides whether n matches, args are the quoted arguments of
+// the call in the query.
+type PredicateFunc func(n *Node, args ...string) bool
+
+var funcMap = map[string]PredicateFunc{}
+var funcLock sync.RWMutex
+
+// RegisterFunc makes f callable in queries as [:name("arg", ...)]. Calls are
+// bound when a query is parsed, so registering a name again does not change
+// queries compiled before.
+func RegisterFunc(name string, f PredicateFunc) error {
+	if !checkName(name) || name[0] == '@' {
+		return ErrInvalidFuncName
+	}
+	if f == nil {
+		return ErrNilFunc
+	}
+	funcLock.Lock()
+	defer funcLock.Unlock()
+	funcMap[name] = f
+	return nil
+}
+
+// UnregisterFunc removes name, queries compiled before keep calling it.
+func UnregisterFunc(name string) {
+	funcLock.Lock()
+	defer funcLock.Unlock()
+	delete(funcMap, name)
+}
+
+func lookupFunc(name string) (PredicateFunc, bool) {
+	funcLock.RLock()
+	defer funcLock.RUnlock()
+	f, ok := funcMap[name]
+	return f, ok
+}
@@ -0,0 +1,141 @@
+package nbsoup
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidThreshold = errors.New("fuzzy threshold must be between 0 and 1")
+
+const defaultThreshold = 0.8
+
+// Scored is a node found by FindBest with the lowest similarity of the ~~=
+// predicates which matched it.
+type Scored struct {
+	Node  *Node
+	Score float64
+}
+
+// FindBest is the same as FindAll but ranks the nodes by their ~~= score,
+// best first. Nodes with the same score keep document order, a query without
+// ~~= predicates scores every node 1.
+func (n *Node) FindBest(queryStr string) ([]Scored, error) {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	return sel.FindBest(n), nil
+}
+
+// FindBest is the same as Node.FindBest with a compiled query.
+func (s *Selector) FindBest(n *Node) []Scored {
+	var scored []Scored
+	for node := range s.Iter(n) {
+		for _, query := range s.union {
+			if node.matchChain(query, n) {
+				scored = append(scored, Scored{node, node.score(query)})
+				break
+			}
+		}
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+	return scored
+}
+
+func (n *Node) score(query *Query) float64 {
+	best := -1.0
+	for _, qList := range query.Predicates {
+		score := 1.0
+		for _, q := range qList {
+			if !n.matchQ(q) {
+				score = -1
+				break
+			}
+			if q.Operator == Fuzzy && q.fn == nil {
+				score = min(score, n.fuzzyScore(q))
+			}
+		}
+		best = max(best, score)
+	}
+	if best < 0 {
+		return 1
+	}
+	return best
+}
+
+func (n *Node) fuzzyScore(q Predicate) float64 {
+	if q.Attr != "@attrs" {
+		value, _ := n.attrValue(q.Attr)
+		return similarity(q.Value, value)
+	}
+	var best float64
+	for _, attr := range n.AttrMap {
+		best = max(best, similarity(q.Value, attr))
+	}
+	return best
+}
+
+// similarity scores a and b between 0 and 1 after normalizing case, spaces
+// and punctuation. It is the better of the edit distance ratio and the
+// Jaccard index of the word sets, so "Make & Model" and "Make/Model" both
+// score 1 against "make model".
+func similarity(a, b string) float64 {
+	ta, tb := tokenize(a), tokenize(b)
+	na, nb := strings.Join(ta, " "), strings.Join(tb, " ")
+	if na == nb {
+		return 1
+	}
+	ra, rb := []rune(na), []rune(nb)
+	editScore := 1 - float64(levenshtein(ra, rb))/float64(max(len(ra), len(rb)))
+	return max(editScore, jaccard(ta, tb))
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func jaccard(a, b []string) float64 {
+	set := make(map[string]int, len(a)+len(b))
+	for _, t := range a {
+		set[t] |= 1
+	}
+	for _, t := range b {
+		set[t] |= 2
+	}
+	if len(set) == 0 {
+		return 0
+	}
+	var both int
+	for _, v := range set {
+		if v == 3 {
+			both++
+		}
+	}
+	return float64(both) / float64(len(set))
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
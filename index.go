@@ -0,0 +1,341 @@
+package nbsoup
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minIndexed is the number of nodes below which a subtree is scanned, since
+// checking them all costs less than planning.
+const minIndexed = 64
+
+// docIndex maps tag names, ids, class tokens and attribute keys to the
+// positions of the elements of a document, each list in document order.
+// nodes holds all nodes under the root in document order, order the position
+// of every node, end the position after its last descendant and parent the
+// position of its parent, -1 for the root.
+type docIndex struct {
+	tags    map[string][]int
+	ids     map[string][]int
+	classes map[string][]int
+	attrs   map[string][]int
+	nodes   []*Node
+	order   map[*Node]int
+	end     []int
+	parent  []int
+}
+
+var indexLock sync.Mutex
+
+// docIndex returns the index of the document n belongs to, building it on
+// first use if build is set and Index has been called. It returns nil if the
+// index is not built.
+func (n *Node) docIndex(build bool) *docIndex {
+	root := n.Root()
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	if root.index == nil && build && root.indexed {
+		root.index = buildIndex(root)
+	}
+	return root.index
+}
+
+// Index makes queries on the document n belongs to use indexes of its tag
+// names, ids, class tokens and attribute keys, built by the next query from
+// the document root. Documents are scanned unless Index is called, since the
+// indexes are not updated when the tree changes: call Reindex after changing
+// the Name, AttrMap, Parent or Children of any of its nodes.
+func (n *Node) Index() {
+	root := n.Root()
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	root.indexed = true
+}
+
+// Reindex drops the indexes of the document n belongs to. Queries from the
+// document root build them again when needed.
+func (n *Node) Reindex() {
+	root := n.Root()
+	indexLock.Lock()
+	defer indexLock.Unlock()
+	root.index = nil
+}
+
+func buildIndex(root *Node) *docIndex {
+	idx := &docIndex{
+		tags:    make(map[string][]int),
+		ids:     make(map[string][]int),
+		classes: make(map[string][]int),
+		attrs:   make(map[string][]int),
+		order:   make(map[*Node]int),
+	}
+	var walk func(n *Node, parent int)
+	walk = func(n *Node, parent int) {
+		for _, child := range n.Children {
+			pos := len(idx.nodes)
+			idx.order[child] = pos
+			idx.nodes = append(idx.nodes, child)
+			idx.end = append(idx.end, 0)
+			idx.parent = append(idx.parent, parent)
+			if child.Name != "" {
+				idx.add(child, pos)
+			}
+			walk(child, pos)
+			idx.end[pos] = len(idx.nodes)
+		}
+	}
+	walk(root, -1)
+	return idx
+}
+
+func (idx *docIndex) add(n *Node, pos int) {
+	idx.tags[n.Name] = append(idx.tags[n.Name], pos)
+	for key, value := range n.AttrMap {
+		idx.attrs[key] = append(idx.attrs[key], pos)
+		switch key {
+		case "id":
+			idx.ids[value] = append(idx.ids[value], pos)
+		case "class":
+			for _, class := range uniqueFields(value) {
+				idx.classes[class] = append(idx.classes[class], pos)
+			}
+		}
+	}
+}
+
+func uniqueFields(s string) []string {
+	fields := strings.Fields(s)
+	l := fields[:0]
+	for i, f := range fields {
+		if !slices.Contains(fields[:i], f) {
+			l = append(l, f)
+		}
+	}
+	return l
+}
+
+// span is a range of positions in docIndex.nodes.
+type span struct {
+	start, end int
+}
+
+// scope returns the span of the nodes under n, or false if n is not in the
+// index.
+func (idx *docIndex) scope(n *Node) (span, bool) {
+	if n.Parent == nil {
+		return span{0, len(idx.nodes)}, true
+	}
+	pos, ok := idx.order[n]
+	if !ok {
+		return span{}, false
+	}
+	return span{pos + 1, idx.end[pos]}, true
+}
+
+// plan returns the spans holding every node in scope which can match the
+// chain ending at last, and the number of nodes in them. It looks up every
+// element of the chain in the indexes and anchors on the cheapest: nodes
+// matching the last element lie in the subtrees of the anchor nodes, or after
+// them among their siblings if the next combinator is + or ~, and are taken
+// from the index of the last element if it has one. It returns false if no
+// element is covered by an index.
+func (idx *docIndex) plan(last *Query, scope span) ([]span, int, bool) {
+	lastLists, lastOK := idx.planElement(last)
+	var best []span
+	bestCost := -1
+	for query := last; query != nil; query = query.Prev {
+		lists, ok := idx.planElement(query)
+		if !ok {
+			continue
+		}
+		var spans []span
+		var cost int
+		for _, l := range lists {
+			for _, pos := range within(l, scope) {
+				r := idx.region(pos, query, last)
+				if !lastOK || query == last {
+					spans = append(spans, r)
+					cost += r.end - r.start
+					continue
+				}
+				for _, ll := range lastLists {
+					for _, p := range within(ll, r) {
+						spans = append(spans, span{p, p + 1})
+						cost++
+					}
+				}
+			}
+			if bestCost >= 0 && cost >= bestCost {
+				break
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = spans, cost
+		}
+	}
+	return best, bestCost, bestCost >= 0
+}
+
+// region returns the span which can hold the nodes matching last when the
+// node at pos matches query.
+func (idx *docIndex) region(pos int, query, last *Query) span {
+	switch {
+	case query == last:
+		return span{pos, pos + 1}
+	case query.Next.Combinator == Adjacent || query.Next.Combinator == Sibling:
+		parentEnd := len(idx.nodes)
+		if p := idx.parent[pos]; p >= 0 {
+			parentEnd = idx.end[p]
+		}
+		return span{idx.end[pos], parentEnd}
+	default:
+		return span{pos + 1, idx.end[pos]}
+	}
+}
+
+// within returns the positions of l, which is sorted, inside s.
+func within(l []int, s span) []int {
+	lo, _ := slices.BinarySearch(l, s.start)
+	hi, _ := slices.BinarySearch(l, s.end)
+	return l[lo:hi]
+}
+
+// planElement returns the lists holding every candidate of a single element
+// of a chain, taken from the most selective index.
+func (idx *docIndex) planElement(query *Query) ([][]int, bool) {
+	best, found := idx.planNames(query)
+	if lists, ok := idx.planPredicates(query); ok && (!found || size(lists) < size(best)) {
+		best, found = lists, true
+	}
+	return best, found
+}
+
+func (idx *docIndex) planNames(query *Query) ([][]int, bool) {
+	if len(query.Names) == 0 {
+		return nil, false
+	}
+	lists := make([][]int, 0, len(query.Names))
+	for _, name := range query.Names {
+		if strings.ContainsAny(name, `*?[\`) {
+			return nil, false
+		}
+		lists = append(lists, idx.tags[name])
+	}
+	return lists, true
+}
+
+// planPredicates picks one list for every OR group of predicates. Every
+// attribute predicate needs the attribute to be present, so the attribute key
+// index covers all of them.
+func (idx *docIndex) planPredicates(query *Query) ([][]int, bool) {
+	if len(query.Predicates) == 0 {
+		return nil, false
+	}
+	lists := make([][]int, 0, len(query.Predicates))
+	for _, qList := range query.Predicates {
+		var best []int
+		found := false
+		for _, q := range qList {
+			l, ok := idx.lookup(q)
+			if ok && (!found || len(l) < len(best)) {
+				best, found = l, true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+		lists = append(lists, best)
+	}
+	return lists, true
+}
+
+func (idx *docIndex) lookup(q Predicate) ([]int, bool) {
+	if q.fn != nil || strings.HasPrefix(q.Attr, "@") {
+		return nil, false
+	}
+	switch {
+	case q.Attr == "id" && q.Operator == Equal:
+		return idx.ids[q.Value], true
+	case q.Attr == "class" && q.Operator == Equal && strings.TrimSpace(q.Value) != "":
+		var best []int
+		for i, class := range strings.Fields(q.Value) {
+			if l := idx.classes[class]; i == 0 || len(l) < len(best) {
+				best = l
+			}
+		}
+		return best, true
+	default:
+		return idx.attrs[q.Attr], true
+	}
+}
+
+func size(lists [][]int) int {
+	var n int
+	for _, l := range lists {
+		n += len(l)
+	}
+	return n
+}
+
+// candidates returns the nodes under n which can match s in document order.
+// The document index is built by queries from the root once Index has been
+// called, queries from a node inside the document use it once built. It
+// returns false if the index is not used, because some query of the union is
+// not covered by it or scanning the subtree of n is as cheap.
+func (s *Selector) candidates(n *Node) ([]*Node, bool) {
+	if n.smaller(minIndexed) {
+		return nil, false
+	}
+	idx := n.docIndex(n.Parent == nil)
+	if idx == nil {
+		return nil, false
+	}
+	scope, ok := idx.scope(n)
+	if !ok {
+		return nil, false
+	}
+	var spans []span
+	var cost int
+	for _, query := range s.union {
+		l, c, ok := idx.plan(query, scope)
+		if !ok {
+			return nil, false
+		}
+		spans = append(spans, l...)
+		cost += c
+	}
+	if cost >= scope.end-scope.start {
+		return nil, false
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	candidates := make([]*Node, 0, cost)
+	next := scope.start
+	for _, sp := range spans {
+		for i := max(sp.start, next); i < min(sp.end, scope.end); i++ {
+			if node := idx.nodes[i]; n.isAncestorOf(node) {
+				candidates = append(candidates, node)
+			}
+		}
+		next = max(next, sp.end)
+	}
+	return candidates, true
+}
+
+// smaller reports whether there are less than limit nodes under n, it stops
+// counting at limit.
+func (n *Node) smaller(limit int) bool {
+	return n.count(limit) < limit
+}
+
+func (n *Node) count(limit int) int {
+	count := len(n.Children)
+	for _, child := range n.Children {
+		if count >= limit {
+			break
+		}
+		count += child.count(limit - count)
+	}
+	return count
+}
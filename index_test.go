@@ -0,0 +1,155 @@
+package nbsoup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestIndexedQuery(t *testing.T) {
+	b, err := os.ReadFile("test.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.Index()
+	list := []string{
+		`td`,
+		`td|th`,
+		`table td[class="auto-style7"]`,
+		`*[id="cse-search-box"]`, `table[id="table9"] td`,
+		`div[id="app" | class*="x"]`,
+		`tr > td[@content*="Make"]`,
+		`a[href*="/"] , img[src%="\.jpg$"]`,
+		`*[class="auto-style7 x" | class!="auto-style13"]`,
+		`font:has(b)`,
+		`table[id="table25"] > tbody > tr > td`,
+		`table[id="table25"] td + td font`,
+		`td[class="auto-style7"] ~ td`,
+		`tr:has(td[class="auto-style7"]) + tr td, table[id="table9"] a`,
+	}
+	for _, queryStr := range list {
+		sel, err := Compile(queryStr)
+		if err != nil {
+			t.Fatalf("%s: %v", queryStr, err)
+		}
+		tables, _ := root.FindAll(`table`)
+		for _, start := range append([]*Node{root, root.Children[0]}, tables...) {
+			got, want := sel.FindAll(start), slices.Collect(sel.filter(start, start.descendants()))
+			if len(got) != len(want) {
+				t.Fatalf("%s: got %d nodes, want %d", queryStr, len(got), len(want))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("%s: node %d differs", queryStr, i)
+				}
+			}
+		}
+	}
+	idx := root.docIndex(false)
+	table, _ := root.FindFirst(`table[id="table25"]`)
+	spans, cost, ok := idx.plan(MustCompile(`table[id="table25"] td`).union[0], span{0, len(idx.nodes)})
+	scope, _ := idx.scope(table)
+	if !ok || cost == 0 || cost >= len(idx.tags["td"]) {
+		t.Fatalf("got %d candidates, want the td nodes of table25", cost)
+	}
+	for _, sp := range spans {
+		if sp.start < scope.start || sp.end > scope.end || idx.nodes[sp.start].Name != "td" {
+			t.Fatalf("got %v outside the td nodes of table25", sp)
+		}
+	}
+	nodes, _ := root.FindAll(`table`)
+	node := &Node{Name: "td", AttrMap: map[string]string{"id": "added"}, Parent: nodes[0]}
+	nodes[0].Children = append(nodes[0].Children, node)
+	root.Reindex()
+	if got, _ := root.FindAll(`td[id="added"]`); len(got) != 1 || got[0] != node {
+		t.Fatalf("got %v", got)
+	}
+	nodes[0].Children = nodes[0].Children[:len(nodes[0].Children)-1]
+	node.Parent = nil
+	if got, _ := root.FindAll(`td[id="added"]`); len(got) != 0 {
+		t.Fatalf("removed node found before Reindex: %v", got)
+	}
+}
+
+func TestUnindexedQuery(t *testing.T) {
+	b, err := os.ReadFile("test.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := root.FindFirst(`p`)
+	p.AttrMap["id"] = "new"
+	if got, _ := root.FindAll(`[id="new"]`); len(got) != 1 || got[0] != p {
+		t.Fatalf("got %v", got)
+	}
+	if root.docIndex(false) != nil {
+		t.Fatal("index built without Index")
+	}
+	small, _ := Parse([]byte(`<ul><li>one</li><li>two</li></ul>`))
+	small.Index()
+	small.FindAll(`li`)
+	if small.docIndex(false) != nil {
+		t.Fatal("index built for a small document")
+	}
+}
+
+func benchDoc(b *testing.B) *Node {
+	var buf bytes.Buffer
+	buf.WriteString("<html><body>")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&buf, `<div class="row r%d"><span id="s%d">%d</span><a href="/%d">link</a></div>`, i%10, i, i, i)
+	}
+	buf.WriteString("</body></html>")
+	root, err := Parse(buf.Bytes())
+	if err != nil {
+		b.Fatal(err)
+	}
+	root.Index()
+	return root
+}
+
+func benchmarkQuery(b *testing.B, queryStr string, indexed bool) {
+	root := benchDoc(b)
+	sel := MustCompile(queryStr)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if indexed {
+			sel.FindAll(root)
+		} else {
+			for range sel.filter(root, root.descendants()) {
+			}
+		}
+	}
+}
+
+func benchmarkRows(b *testing.B, indexed bool) {
+	root := benchDoc(b)
+	rows, _ := root.FindAll(`div`)
+	sel := MustCompile(`a[href*="/"]`)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, row := range rows {
+			if indexed {
+				sel.FindAll(row)
+			} else {
+				_ = slices.Collect(sel.filter(row, row.descendants()))
+			}
+		}
+	}
+}
+
+func BenchmarkFindInRows(b *testing.B)     { benchmarkRows(b, true) }
+func BenchmarkFindInRowsScan(b *testing.B) { benchmarkRows(b, false) }
+func BenchmarkFindID(b *testing.B)         { benchmarkQuery(b, `span[id="s4000"]`, true) }
+func BenchmarkFindIDScan(b *testing.B)     { benchmarkQuery(b, `span[id="s4000"]`, false) }
+func BenchmarkFindClass(b *testing.B)      { benchmarkQuery(b, `div[class="row r3"] > a`, true) }
+func BenchmarkFindClassScan(b *testing.B)  { benchmarkQuery(b, `div[class="row r3"] > a`, false) }
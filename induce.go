@@ -0,0 +1,340 @@
+package nbsoup
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var ErrNoExamples = errors.New("no positive examples")
+var ErrNoQueryFound = errors.New("no query matches all positives and no negatives")
+
+// maxFeatures bounds the number of predicates InduceQuery puts in the last
+// query element, an ancestor adds up to two more. maxDepth is the number of
+// ancestor levels it looks at.
+const (
+	maxFeatures   = 3
+	maxDepth      = 3
+	maxContentLen = 80
+)
+
+// feature is a tag name list or a single predicate shared by all examples.
+type feature struct {
+	names []string
+	pred  Predicate
+}
+
+func (f feature) apply(query *Query) {
+	if f.names != nil {
+		query.Names = f.names
+		return
+	}
+	query.Attr(f.pred.Attr, f.pred.Operator, f.pred.Value)
+}
+
+type ancestorStep struct {
+	comb     Combinator
+	features []feature
+}
+
+// InduceQuery returns the most general query which, run from root, matches
+// every positive and no negative. It looks at tag names, attributes and
+// @content patterns shared by the positives and by their ancestors, tries
+// queries with fewer predicates first and among those picks the one matching
+// the most nodes.
+func InduceQuery(root *Node, positives, negatives []*Node) (string, error) {
+	if len(positives) == 0 {
+		return "", ErrNoExamples
+	}
+	targets := commonFeatures(positives, true)
+	ancestors := []*ancestorStep{nil}
+	level := positives
+	for d := 1; d <= maxDepth; d++ {
+		level = parents(level, root)
+		if level == nil {
+			break
+		}
+		comb := Descendant
+		if d == 1 {
+			comb = Child
+		}
+		all := commonFeatures(level, false)
+		for i, f := range all {
+			if i > 0 && all[0].names != nil {
+				ancestors = append(ancestors, &ancestorStep{comb, []feature{all[0], f}})
+			} else {
+				ancestors = append(ancestors, &ancestorStep{comb, []feature{f}})
+			}
+		}
+	}
+	var best string
+	bestCount := -1
+	for size := 1; size <= maxFeatures+2 && best == ""; size++ {
+		for _, anc := range ancestors {
+			k := size
+			if anc != nil {
+				k -= len(anc.features)
+			}
+			if k < 0 || k == 0 && anc == nil || k > len(targets) {
+				continue
+			}
+			for _, subset := range subsets(len(targets), k) {
+				last := buildInduced(anc, targets, subset)
+				sel, err := NewSelector(last)
+				if err != nil || !sel.separates(root, positives, negatives) {
+					continue
+				}
+				s := sel.String()
+				count := len(sel.FindAll(root))
+				if count > bestCount || count == bestCount && len(s) < len(best) {
+					best, bestCount = s, count
+				}
+			}
+		}
+	}
+	if best == "" {
+		return "", ErrNoQueryFound
+	}
+	return best, nil
+}
+
+func buildInduced(anc *ancestorStep, targets []feature, subset []int) *Query {
+	last := Q()
+	for _, i := range subset {
+		targets[i].apply(last)
+	}
+	if anc == nil {
+		return last
+	}
+	head := Q()
+	for _, f := range anc.features {
+		f.apply(head)
+	}
+	if anc.comb == Child {
+		return head.Child(last)
+	}
+	return head.Descendant(last)
+}
+
+func (s *Selector) separates(root *Node, positives, negatives []*Node) bool {
+	for _, n := range positives {
+		if !root.isAncestorOf(n) || !s.union.match(n, root) {
+			return false
+		}
+	}
+	for _, n := range negatives {
+		if root.isAncestorOf(n) && s.union.match(n, root) {
+			return false
+		}
+	}
+	return true
+}
+
+// parents returns the parent of every node, or nil if one of them has no
+// element parent inside root.
+func parents(nodes []*Node, root *Node) []*Node {
+	l := make([]*Node, 0, len(nodes))
+	for _, n := range nodes {
+		if n.Parent == nil || n.Parent == root || n.Parent.Name == "" {
+			return nil
+		}
+		l = append(l, n.Parent)
+	}
+	return l
+}
+
+// subsets returns all sets of k indexes below n in lexical order.
+func subsets(n, k int) [][]int {
+	var l [][]int
+	var gen func(start int, cur []int)
+	gen = func(start int, cur []int) {
+		if len(cur) == k {
+			l = append(l, append([]int(nil), cur...))
+			return
+		}
+		for i := start; i < n; i++ {
+			gen(i+1, append(cur, i))
+		}
+	}
+	gen(0, make([]int, 0, k))
+	return l
+}
+
+// commonFeatures lists the tag names, attribute predicates and, if content is
+// set, the @content predicates all nodes share.
+func commonFeatures(nodes []*Node, content bool) []feature {
+	var features []feature
+	names := make([]string, 0, 4)
+	for _, n := range nodes {
+		if !slices.Contains(names, n.Name) {
+			names = append(names, n.Name)
+		}
+	}
+	if len(names) <= 3 {
+		sort.Strings(names)
+		features = append(features, feature{names: names})
+	}
+	keys := make([]string, 0, len(nodes[0].AttrMap))
+	for key := range nodes[0].AttrMap {
+		if nameCheckRe.MatchString(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyRank(keys[i]) < keyRank(keys[j]) || keyRank(keys[i]) == keyRank(keys[j]) && keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		values := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			v, ok := n.AttrMap[key]
+			if !ok {
+				break
+			}
+			values = append(values, v)
+		}
+		if len(values) < len(nodes) {
+			continue
+		}
+		if key == "class" {
+			for _, class := range commonTokens(values) {
+				features = append(features, feature{pred: Predicate{Attr: key, Operator: Contains, Value: class}})
+			}
+			continue
+		}
+		features = append(features, valueFeatures(key, values, false)...)
+	}
+	if content {
+		values := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			values = append(values, n.Content)
+		}
+		features = append(features, valueFeatures("@content", values, true)...)
+	}
+	return features
+}
+
+func keyRank(key string) int {
+	switch key {
+	case "id":
+		return 0
+	case "class":
+		return 1
+	default:
+		return 2
+	}
+}
+
+func valueFeatures(attr string, values []string, shape bool) []feature {
+	same := true
+	for _, v := range values[1:] {
+		if v != values[0] {
+			same = false
+			break
+		}
+	}
+	if same {
+		if strings.TrimSpace(values[0]) == "" || len(values[0]) > maxContentLen {
+			return nil
+		}
+		return []feature{{pred: Predicate{Attr: attr, Operator: Equal, Value: values[0]}}}
+	}
+	var features []feature
+	if shape {
+		if pattern, ok := commonShape(values); ok {
+			features = append(features, feature{pred: Predicate{Attr: attr, Operator: Regexp, Value: pattern}})
+		}
+	}
+	if common := longestCommonSubstring(values); len(strings.TrimSpace(common)) >= 3 {
+		features = append(features, feature{pred: Predicate{Attr: attr, Operator: Contains, Value: common}})
+	}
+	return features
+}
+
+func commonTokens(values []string) []string {
+	tokens := uniqueFields(values[0])
+	l := tokens[:0]
+	for _, t := range tokens {
+		found := true
+		for _, v := range values[1:] {
+			if !slices.Contains(strings.Fields(v), t) {
+				found = false
+				break
+			}
+		}
+		if found {
+			l = append(l, t)
+		}
+	}
+	return l
+}
+
+// commonShape returns a regular expression like `^\d+\s+\pL+$` if all values
+// have the same sequence of digit, letter, space and other runs.
+func commonShape(values []string) (string, bool) {
+	var pattern string
+	for i, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || len(v) > maxContentLen {
+			return "", false
+		}
+		p := shape(v)
+		if i > 0 && p != pattern {
+			return "", false
+		}
+		pattern = p
+	}
+	return `^\s*` + pattern + `\s*$`, true
+}
+
+func shape(s string) string {
+	var b strings.Builder
+	var last string
+	for _, r := range s {
+		var class string
+		switch {
+		case unicode.IsDigit(r):
+			class = `\d+`
+		case unicode.IsLetter(r):
+			class = `\pL+`
+		case unicode.IsSpace(r):
+			class = `\s+`
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			last = ""
+			continue
+		}
+		if class != last {
+			b.WriteString(class)
+			last = class
+		}
+	}
+	return b.String()
+}
+
+func longestCommonSubstring(values []string) string {
+	base := []rune(values[0])
+	if len(base) > 4*maxContentLen {
+		return ""
+	}
+	var best string
+	for i := range base {
+		for j := len(base); j > i+len([]rune(best)); j-- {
+			sub := string(base[i:j])
+			found := true
+			for _, v := range values[1:] {
+				if !strings.Contains(v, sub) {
+					found = false
+					break
+				}
+			}
+			if found {
+				best = sub
+				break
+			}
+		}
+	}
+	return best
+}
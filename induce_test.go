@@ -0,0 +1,62 @@
+package nbsoup
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestInduceQuery(t *testing.T) {
+	b, err := os.ReadFile("test.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, _ := root.FindFirst(`table[id="table25"]`)
+	labels, _ := table.FindAll(`tr > td:nth(1)`)
+	values, _ := table.FindAll(`tr > td:nth(2)`)
+	fonts, _ := table.FindAll(`td:nth(1) font`)
+	others, _ := table.FindAll(`td:nth(2) font`)
+	list := []struct {
+		positives, negatives []*Node
+	}{
+		{labels[:3], values[:3]},
+		{labels, values},
+		{labels[:2], values},
+		{fonts[:2], others[:2]},
+		{values[1:2], labels},
+	}
+	for i, c := range list {
+		queryStr, err := InduceQuery(root, c.positives, c.negatives)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		nodes, err := root.FindAll(queryStr)
+		if err != nil {
+			t.Fatalf("%s: %v", queryStr, err)
+		}
+		found := make(map[*Node]bool, len(nodes))
+		for _, n := range nodes {
+			found[n] = true
+		}
+		for _, n := range c.positives {
+			if !found[n] {
+				t.Fatalf("%s: positive not matched", queryStr)
+			}
+		}
+		for _, n := range c.negatives {
+			if found[n] {
+				t.Fatalf("%s: negative matched", queryStr)
+			}
+		}
+	}
+	if _, err := InduceQuery(root, nil, values); !errors.Is(err, ErrNoExamples) {
+		t.Fatalf("got %v", err)
+	}
+	if _, err := InduceQuery(root, labels[:1], labels[:1]); !errors.Is(err, ErrNoQueryFound) {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package nbsoup
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrUnterminatedString = errors.New("unterminated string")
+var ErrInvalidPlaceholder = errors.New("invalid placeholder")
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokSpace
+	tokIdent
+	tokString
+	tokNumber
+	tokOperator
+	tokCombinator
+	tokLBracket
+	tokRBracket
+	tokLParen
+	tokRParen
+	tokColon
+	tokAnd
+	tokOr
+	tokComma
+	tokSlash
+	tokPlaceholder
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+type lexer struct {
+	src          []rune
+	pos          int
+	bracketDepth int
+	tokens       []token
+}
+
+func lex(s string) ([]token, error) {
+	l := &lexer{src: []rune(s), tokens: make([]token, 0, 32)}
+	for l.pos < len(l.src) {
+		var err error
+		if l.bracketDepth > 0 {
+			err = l.lexPredicate()
+		} else {
+			err = l.lexSelector()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	l.emit(tokEOF, "", l.pos)
+	return l.tokens, nil
+}
+
+func (l *lexer) emit(kind tokenKind, value string, pos int) {
+	l.tokens = append(l.tokens, token{kind, value, pos})
+}
+
+func (l *lexer) peekRune(offset int) rune {
+	if l.pos+offset >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos+offset]
+}
+
+func (l *lexer) lexSelector() error {
+	start := l.pos
+	r := l.src[l.pos]
+	switch {
+	case r == ' ' || r == '\t':
+		for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t') {
+			l.pos++
+		}
+		l.emit(tokSpace, " ", start)
+		return nil
+	case r == '.' && l.peekRune(1) == '.':
+		l.pos += 2
+		l.emit(tokCombinator, "..", start)
+		return nil
+	case r == '.' || r == '>' || r == '+' || r == '~':
+		l.pos++
+		l.emit(tokCombinator, string(r), start)
+		return nil
+	case r == '[':
+		l.pos++
+		l.bracketDepth++
+		l.emit(tokLBracket, "[", start)
+		return nil
+	case r == '(':
+		l.pos++
+		l.emit(tokLParen, "(", start)
+		return nil
+	case r == ')':
+		l.pos++
+		l.emit(tokRParen, ")", start)
+		return nil
+	case r == ':':
+		l.pos++
+		l.emit(tokColon, ":", start)
+		return nil
+	case r == ',':
+		l.pos++
+		l.emit(tokComma, ",", start)
+		return nil
+	case r == '/':
+		l.pos++
+		l.emit(tokSlash, "/", start)
+		return nil
+	case r == '|':
+		l.pos++
+		l.emit(tokOr, "|", start)
+		return nil
+	case isIdentRune(r) || r == '*':
+		l.lexIdent()
+		return nil
+	default:
+		return ErrInvalidCharacter
+	}
+}
+
+func (l *lexer) lexPredicate() error {
+	start := l.pos
+	r := l.src[l.pos]
+	switch {
+	case r == ' ' || r == '\t':
+		l.pos++
+		return nil
+	case r == ']':
+		l.pos++
+		l.bracketDepth--
+		l.emit(tokRBracket, "]", start)
+		return nil
+	case r == '&':
+		l.pos++
+		l.emit(tokAnd, "&", start)
+		return nil
+	case r == ':':
+		l.pos++
+		l.emit(tokColon, ":", start)
+		return nil
+	case r == '(':
+		l.pos++
+		l.emit(tokLParen, "(", start)
+		return nil
+	case r == ')':
+		l.pos++
+		l.emit(tokRParen, ")", start)
+		return nil
+	case r == ',':
+		l.pos++
+		l.emit(tokComma, ",", start)
+		return nil
+	case r == '/':
+		l.pos++
+		l.emit(tokSlash, "/", start)
+		return nil
+	case r == '|':
+		l.pos++
+		l.emit(tokOr, "|", start)
+		return nil
+	case r == '"' || r == '\'':
+		return l.lexString(false)
+	case r == '?':
+		l.pos++
+		l.emit(tokPlaceholder, "", start)
+		return nil
+	case r == '$':
+		l.pos++
+		for l.pos < len(l.src) && isIdentRune(l.src[l.pos]) && l.src[l.pos] != '@' {
+			l.pos++
+		}
+		if l.pos == start+1 {
+			return ErrInvalidPlaceholder
+		}
+		l.emit(tokPlaceholder, string(l.src[start+1:l.pos]), start)
+		return nil
+	case r == 'r' && (l.peekRune(1) == '"' || l.peekRune(1) == '\''):
+		l.pos++
+		return l.lexString(true)
+	case strings.ContainsRune(operatorRunes, r):
+		for l.pos < len(l.src) && strings.ContainsRune(operatorRunes, l.src[l.pos]) {
+			l.pos++
+		}
+		l.emit(tokOperator, string(l.src[start:l.pos]), start)
+		return nil
+	case unicode.IsDigit(r):
+		for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		l.emit(tokNumber, string(l.src[start:l.pos]), start)
+		return nil
+	case isIdentRune(r):
+		l.lexIdent()
+		return nil
+	default:
+		return ErrInvalidCharacter
+	}
+}
+
+const operatorRunes = "=!*%<>~"
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '-' || r == '@' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (l *lexer) lexIdent() {
+	start := l.pos
+	for l.pos < len(l.src) && (isIdentRune(l.src[l.pos]) || l.bracketDepth == 0 && l.src[l.pos] == '*') {
+		l.pos++
+	}
+	l.emit(tokIdent, string(l.src[start:l.pos]), start)
+}
+
+// lexString reads a quoted value. A backslash only escapes the quote and the
+// backslash itself, so regular expressions like "\d+" keep their meaning. Raw
+// strings have no escapes at all.
+func (l *lexer) lexString(raw bool) error {
+	start := l.pos
+	quote := l.src[l.pos]
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		r := l.src[l.pos]
+		switch {
+		case r == quote:
+			l.pos++
+			l.emit(tokString, b.String(), start)
+			return nil
+		case r == '\\' && !raw && (l.peekRune(1) == quote || l.peekRune(1) == '\\'):
+			b.WriteRune(l.peekRune(1))
+			l.pos += 2
+		default:
+			b.WriteRune(r)
+			l.pos++
+		}
+	}
+	return ErrUnterminatedString
+}
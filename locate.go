@@ -0,0 +1,247 @@
+package nbsoup
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// unstableRe matches ids and class names which look generated and likely to
+// change between page loads.
+var unstableRe = regexp.MustCompile(`\d{3,}`)
+
+var cssIdentRe = regexp.MustCompile(`^-?[_a-zA-Z][\w-]*$`)
+
+// Selector returns the shortest query found which matches exactly n when
+// run from its root, for example `div[id="app"] > p`. Ids are preferred, then
+// class names which do not look generated, then positions among siblings of
+// the same tag. Every candidate is run from the root. It returns "" for a
+// node without a name and for the root.
+func (n *Node) Selector() string {
+	steps, anchored := n.locate()
+	if steps == nil {
+		return ""
+	}
+	return buildLocator(steps, anchored).String()
+}
+
+// CSS is the same as Selector in CSS syntax.
+func (n *Node) CSS() string {
+	steps, _ := n.locate()
+	var b strings.Builder
+	for i, s := range steps {
+		if i > 0 {
+			b.WriteString(" > ")
+		}
+		b.WriteString(cssIdent(s.node.Name))
+		switch attr, value := s.node.locatorKey(); {
+		case attr == "id" && cssIdentRe.MatchString(value):
+			b.WriteString("#" + value)
+		case attr == "id":
+			b.WriteString("[id=" + cssString(value) + "]")
+		case attr == "class" && cssIdentRe.MatchString(value):
+			b.WriteString("." + value)
+		case attr == "class":
+			b.WriteString("[class~=" + cssString(value) + "]")
+		}
+		if s.nth {
+			b.WriteString(":nth-of-type(" + strconv.Itoa(s.node.typeIndex()) + ")")
+		}
+	}
+	return b.String()
+}
+
+// XPath is the same as Selector as an XPath expression.
+func (n *Node) XPath() string {
+	steps, anchored := n.locate()
+	var b strings.Builder
+	for i, s := range steps {
+		if i > 0 || anchored {
+			b.WriteString("/")
+		} else {
+			b.WriteString("//")
+		}
+		if isIdent(s.node.Name) {
+			b.WriteString(s.node.Name)
+		} else {
+			b.WriteString("*[name()=" + xpathString(s.node.Name) + "]")
+		}
+		if s.nth {
+			b.WriteString("[" + strconv.Itoa(s.node.typeIndex()) + "]")
+		}
+		switch attr, value := s.node.locatorKey(); attr {
+		case "id":
+			b.WriteString("[@id=" + xpathString(value) + "]")
+		case "class":
+			b.WriteString(`[contains(concat(" ", normalize-space(@class), " "), ` + xpathString(" "+value+" ") + ")]")
+		}
+	}
+	return b.String()
+}
+
+func cssString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\a `).Replace(s) + `"`
+}
+
+// cssIdent escapes the characters of a tag name which CSS does not allow in
+// identifiers, like the : of fb:like.
+func cssIdent(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '_' || r == '-' && i > 0 || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= 0x80:
+		case r >= '0' && r <= '9' && i > 0:
+		case r >= '0' && r <= '9':
+			b.WriteString(`\3` + string(r) + " ")
+			continue
+		default:
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func xpathString(s string) string {
+	switch {
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`
+	case !strings.Contains(s, `'`):
+		return `'` + s + `'`
+	default:
+		return `concat("` + strings.ReplaceAll(s, `"`, `", '"', "`) + `")`
+	}
+}
+
+func isIdent(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !isIdentRune(r) }) < 0
+}
+
+// classPattern matches value as one of the whitespace separated tokens of an
+// attribute, unlike *= it does not match card in cardinal.
+func classPattern(value string) string {
+	return `(^|\s)` + regexp.QuoteMeta(value) + `(\s|$)`
+}
+
+type locateStep struct {
+	node *Node
+	nth  bool
+}
+
+// locate returns the steps of the query found by Selector from the outermost
+// and whether the first step is a child of the root, or nil. Steps are added
+// from n up to the root until the chain matches only n.
+func (n *Node) locate() ([]locateStep, bool) {
+	root := n.Root()
+	if n.Name == "" || n == root {
+		return nil, false
+	}
+	steps := make([]locateStep, 0, 8)
+	for cur := n; cur != root; cur = cur.Parent {
+		for _, nth := range []bool{false, true} {
+			if nth && !cur.hasTypeSiblings() {
+				break
+			}
+			candidate := append([]locateStep{{cur, nth}}, steps...)
+			if buildLocator(candidate, false).matchesOnly(n, root) {
+				return candidate, false
+			}
+		}
+		steps = append([]locateStep{{cur, cur.hasTypeSiblings()}}, steps...)
+	}
+	if !buildLocator(steps, true).matchesOnly(n, root) {
+		return nil, false
+	}
+	return steps, true
+}
+
+// buildLocator returns the last element of the chain of steps, anchored to
+// the root with > if anchored is set.
+func buildLocator(steps []locateStep, anchored bool) *Query {
+	var last *Query
+	for _, s := range steps {
+		step := s.node.locatorStep(s.nth)
+		if last == nil {
+			last = step
+		} else {
+			last = last.Child(step)
+		}
+	}
+	if anchored {
+		last.first().Combinator = Child
+	}
+	return last
+}
+
+func (last *Query) matchesOnly(n, root *Node) bool {
+	sel, err := NewSelector(last)
+	if err != nil {
+		return false
+	}
+	var count int
+	for node := range sel.Iter(root) {
+		if node != n || count > 0 {
+			return false
+		}
+		count++
+	}
+	return count == 1
+}
+
+// locatorStep describes n by its tag, its id or else a stable class name, and
+// its position among the siblings of the same tag if nth is set. A tag name
+// which is not a query identifier is matched with @name.
+func (n *Node) locatorStep(nth bool) *Query {
+	step := Q(n.Name)
+	if !isIdent(n.Name) {
+		step = Q().Attr("@name", Equal, n.Name)
+	}
+	switch attr, value := n.locatorKey(); attr {
+	case "id":
+		step.Attr("id", Equal, value)
+	case "class":
+		step.Attr("class", Regexp, classPattern(value))
+	}
+	if nth {
+		step.NthOfType(n.typeIndex())
+	}
+	return step
+}
+
+// locatorKey returns "id" and the id of n if it looks stable, else "class" and
+// the first class name which does, or "".
+func (n *Node) locatorKey() (string, string) {
+	if id := n.AttrMap["id"]; strings.TrimSpace(id) != "" && !unstableRe.MatchString(id) {
+		return "id", id
+	}
+	for _, class := range strings.Fields(n.AttrMap["class"]) {
+		if !unstableRe.MatchString(class) {
+			return "class", class
+		}
+	}
+	return "", ""
+}
+
+func (n *Node) hasTypeSiblings() bool {
+	for _, sibling := range n.elementSiblings() {
+		if sibling != n && sibling.Name == n.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// typeIndex is the position of n among the element siblings with its tag,
+// starting from 1.
+func (n *Node) typeIndex() int {
+	i := 0
+	for _, sibling := range n.elementSiblings() {
+		if sibling.Name == n.Name {
+			i++
+		}
+		if sibling == n {
+			break
+		}
+	}
+	return i
+}
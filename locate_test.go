@@ -0,0 +1,78 @@
+package nbsoup
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []struct {
+		query, path, css, xpath string
+	}{
+		{`li[class="x"]`, `li[class%=r"(^|\s)x(\s|$)"]`, `li.x`, `//li[contains(concat(" ", normalize-space(@class), " "), " x ")]`},
+		{`li[@content="one"]`, `li:nth-of-type(1)`, `li:nth-of-type(1)`, `//li[1]`},
+		{`p[@content="para"]`, `div[id="app"] > p`, `div#app > p`, `//div[@id="app"]/p`},
+		{`span`, `span`, `span`, `//span`},
+		{`body`, `body`, `body`, `//body`},
+	}
+	for _, c := range list {
+		n, _ := root.FindFirst(c.query)
+		if s := n.Selector(); s != c.path {
+			t.Fatalf("%s: got %s, want %s", c.query, s, c.path)
+		}
+		if s := n.CSS(); s != c.css {
+			t.Fatalf("%s: got %s, want %s", c.query, s, c.css)
+		}
+		if s := n.XPath(); s != c.xpath {
+			t.Fatalf("%s: got %s, want %s", c.query, s, c.xpath)
+		}
+	}
+	if root.Selector() != "" {
+		t.Fatal("root has a path")
+	}
+	tokens, err := Parse([]byte(`<div><span class="cardinal">a</span><span class="card">b</span><fb:like>c</fb:like><fb:like>d</fb:like></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		query, path, css, xpath string
+	}{
+		{`span[@content="b"]`, `span[class%=r"(^|\s)card(\s|$)"]`, `span.card`, `//span[contains(concat(" ", normalize-space(@class), " "), " card ")]`},
+		{`[@content="d"]`, `[@name="fb:like"]:nth-of-type(2)`, `fb\:like:nth-of-type(2)`, `//*[name()="fb:like"][2]`},
+	} {
+		n, _ := tokens.FindFirst(c.query)
+		if s := n.Selector(); s != c.path {
+			t.Fatalf("%s: got %s, want %s", c.query, s, c.path)
+		}
+		if s := n.CSS(); s != c.css {
+			t.Fatalf("%s: got %s, want %s", c.query, s, c.css)
+		}
+		if s := n.XPath(); s != c.xpath {
+			t.Fatalf("%s: got %s, want %s", c.query, s, c.xpath)
+		}
+		if nodes, err := tokens.FindAll(c.path); err != nil || len(nodes) != 1 || nodes[0] != n {
+			t.Fatalf("%s: got %d nodes, %v", c.path, len(nodes), err)
+		}
+	}
+	b, err := os.ReadFile("test.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root, err = Parse(b); err != nil {
+		t.Fatal(err)
+	}
+	for n := range root.Descendants() {
+		s := n.Selector()
+		nodes, err := root.FindAll(s)
+		if err != nil || len(nodes) != 1 || nodes[0] != n {
+			t.Fatalf("%s: got %d nodes, %v", s, len(nodes), err)
+		}
+		if n.CSS() == "" || n.XPath() == "" {
+			t.Fatalf("%s: no CSS or XPath", s)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package nbsoup
+
+import "sort"
+
+// Match is a node found by FindMatches with the capture groups of the %=
+// predicates of the last query element which matched it. Only the first |
+// alternative the node satisfies is captured.
+type Match struct {
+	Node *Node
+	// Submatches holds one entry per matching %= predicate in query order,
+	// entry[0] is the whole match and entry[i] the i-th group.
+	Submatches [][]string
+	// Named maps group names to their values. If several predicates use the
+	// same name the later one wins.
+	Named map[string]string
+}
+
+// FindMatches is the same as FindAll but also returns the capture groups of
+// the regular expressions which matched each node.
+func (n *Node) FindMatches(queryStr string) ([]Match, error) {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	return sel.FindMatches(n), nil
+}
+
+// FindMatches is the same as Node.FindMatches with a compiled query.
+func (s *Selector) FindMatches(n *Node) []Match {
+	var matches []Match
+	for node := range s.Iter(n) {
+		for _, query := range s.union {
+			if node.matchChain(query, n) {
+				matches = append(matches, node.captures(query))
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// captures collects the groups of the first & group of the last query
+// element which n satisfies, alternatives which failed add nothing.
+func (n *Node) captures(query *Query) Match {
+	match := Match{Node: n, Named: make(map[string]string)}
+	for _, qList := range query.Predicates {
+		if !n.matchQList([][]Predicate{qList}) {
+			continue
+		}
+		for _, q := range qList {
+			if q.Operator != Regexp || q.fn != nil {
+				continue
+			}
+			sub := n.submatch(q)
+			if sub == nil {
+				continue
+			}
+			match.Submatches = append(match.Submatches, sub)
+			for i, name := range q.re.SubexpNames() {
+				if name != "" && i < len(sub) {
+					match.Named[name] = sub[i]
+				}
+			}
+		}
+		break
+	}
+	return match
+}
+
+func (n *Node) submatch(q Predicate) []string {
+	if q.Attr == "@attrs" {
+		keys := make([]string, 0, len(n.AttrMap))
+		for k := range n.AttrMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if sub := q.re.FindStringSubmatch(n.AttrMap[k]); sub != nil {
+				return sub
+			}
+		}
+		return nil
+	}
+	value, ok := n.attrValue(q.Attr)
+	if !ok {
+		return nil
+	}
+	return q.re.FindStringSubmatch(value)
+}
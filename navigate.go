@@ -0,0 +1,111 @@
+package nbsoup
+
+import "iter"
+
+// Root returns the top node of the tree n belongs to.
+func (n *Node) Root() *Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return n
+}
+
+// Closest returns n itself or its nearest ancestor matched by the query, or
+// nil if there is none.
+func (n *Node) Closest(queryStr string) (*Node, error) {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	return sel.Closest(n), nil
+}
+
+// Closest is the same as Node.Closest with a compiled query.
+func (s *Selector) Closest(n *Node) *Node {
+	for ; n != nil; n = n.Parent {
+		if s.Match(n) {
+			return n
+		}
+	}
+	return nil
+}
+
+// The iterators below yield element nodes only. If filters are given a node
+// must match all of them, with the whole document as the start node.
+
+// Ancestors yields the ancestors of n from its parent up.
+func (n *Node) Ancestors(filters ...*Selector) iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for p := n.Parent; p != nil; p = p.Parent {
+			if p.pass(filters) && !yield(p) {
+				return
+			}
+		}
+	}
+}
+
+// Descendants yields the nodes under n in document order.
+func (n *Node) Descendants(filters ...*Selector) iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for d := range n.descendants() {
+			if d.pass(filters) && !yield(d) {
+				return
+			}
+		}
+	}
+}
+
+// NextSiblings yields the siblings after n, nearest first.
+func (n *Node) NextSiblings(filters ...*Selector) iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for next := n.nextElement(); next != nil; next = next.nextElement() {
+			if next.pass(filters) && !yield(next) {
+				return
+			}
+		}
+	}
+}
+
+// PrevSiblings yields the siblings before n, nearest first.
+func (n *Node) PrevSiblings(filters ...*Selector) iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for prev := n.prevElement(); prev != nil; prev = prev.prevElement() {
+			if prev.pass(filters) && !yield(prev) {
+				return
+			}
+		}
+	}
+}
+
+// FirstChild returns the first element child of n passing the filters, or
+// nil.
+func (n *Node) FirstChild(filters ...*Selector) *Node {
+	for _, child := range n.Children {
+		if child.pass(filters) {
+			return child
+		}
+	}
+	return nil
+}
+
+// LastChild returns the last element child of n passing the filters, or nil.
+func (n *Node) LastChild(filters ...*Selector) *Node {
+	for i := len(n.Children) - 1; i >= 0; i-- {
+		if n.Children[i].pass(filters) {
+			return n.Children[i]
+		}
+	}
+	return nil
+}
+
+func (n *Node) pass(filters []*Selector) bool {
+	if n.Name == "" {
+		return false
+	}
+	for _, sel := range filters {
+		if !sel.Match(n) {
+			return false
+		}
+	}
+	return true
+}
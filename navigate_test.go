@@ -0,0 +1,52 @@
+package nbsoup
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNavigation(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	span, _ := root.FindFirst(`span`)
+	check := func(nodes []*Node, want string) {
+		t.Helper()
+		got := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			got = append(got, n.Name)
+		}
+		if s := strings.Join(got, ","); s != want {
+			t.Fatalf("got %s, want %s", s, want)
+		}
+	}
+	check(slices.Collect(span.Ancestors()), "p,div,body,html")
+	check(slices.Collect(span.Ancestors(MustCompile(`div`))), "div")
+	if n, err := span.Closest(`div[id="app"]`); err != nil || n == nil || n.AttrMap["id"] != "app" {
+		t.Fatalf("got %v, %v", n, err)
+	}
+	if n, _ := span.Closest(`span`); n != span {
+		t.Fatalf("got %v", n)
+	}
+	if n, _ := span.Closest(`table`); n != nil {
+		t.Fatalf("got %v", n)
+	}
+	app, _ := root.FindFirst(`div[id="app"]`)
+	check(slices.Collect(app.Descendants()), "ul,li,li,li,p,span,div,p")
+	check(slices.Collect(app.Descendants(MustCompile(`p`))), "p,p")
+	ul := app.FirstChild()
+	check([]*Node{ul, app.LastChild(), app.LastChild(MustCompile(`p`))}, "ul,div,p")
+	check(slices.Collect(ul.NextSiblings()), "p,div")
+	check(slices.Collect(app.LastChild().PrevSiblings()), "p,ul")
+	if span.Root() != root {
+		t.Fatal("wrong root")
+	}
+	var first *Node
+	for n := range root.Descendants() {
+		first = n
+		break
+	}
+	check([]*Node{first}, "html")
+}
@@ -3,6 +3,7 @@ package nbsoup
 import (
 	"bytes"
 	"errors"
+	"iter"
 	"regexp"
 	"strings"
 
@@ -12,6 +13,9 @@ import (
 var ErrEndTagNotMatch = errors.New("end tag not match start tag")
 var ErrEmptyNode = errors.New("empty node")
 
+// Node is a node of a parsed document. The fields may be changed, but after
+// Index has been called the indexes of the document are not updated, call
+// Reindex after changing Name, AttrMap, Parent or Children.
 type Node struct {
 	Name     string
 	AttrMap  map[string]string
@@ -20,111 +24,94 @@ type Node struct {
 	Children []*Node
 	Next     *Node
 	Previous *Node
+	index    *docIndex
+	indexed  bool
 }
 
-func (n *Node) matchQ(q q) bool {
-	if q.name == "@content" {
-		switch q.operator {
-		case equal:
-			return n.Content == q.value
-		case notEqual:
-			return n.Content != q.value
-		case include:
-			return strings.Contains(n.Content, q.value)
-		case except:
-			return !strings.Contains(n.Content, q.value)
-		case reg:
-			re := regexp.MustCompile(q.value)
-			return re.MatchString(n.Content)
+func (n *Node) matchQ(q Predicate) bool {
+	if q.fn != nil {
+		return q.fn(n, q.Args...) != q.Negate
+	}
+	if q.Attr == "@attrs" {
+		for _, attr := range n.AttrMap {
+			if q.matchValue(attr) {
+				return true
+			}
 		}
+		return false
 	}
-	attr, ok := n.AttrMap[q.name]
+	value, ok := n.attrValue(q.Attr)
 	if !ok {
 		return false
 	}
-	switch q.operator {
-	case equal:
-		if attr == q.value {
-			return true
-		}
-		return false
-	case notEqual:
-		if attr != q.value {
-			return true
-		}
-		return false
-	case include:
-		return strings.Contains(attr, q.value)
-	case except:
-		return !strings.Contains(attr, q.value)
-	case reg:
-		re := regexp.MustCompile(q.value)
-		return re.MatchString(attr)
+	return q.matchValue(value)
+}
+
+func (q Predicate) matchValue(value string) bool {
+	switch q.Operator {
+	case Equal:
+		return value == q.Value
+	case NotEqual:
+		return value != q.Value
+	case Contains:
+		return strings.Contains(value, q.Value)
+	case NotContains:
+		return !strings.Contains(value, q.Value)
+	case Regexp:
+		return q.re.MatchString(value)
+	case Less, LessEqual, Greater, GreaterEqual, Between:
+		return q.compare(value)
+	case Fuzzy:
+		return similarity(q.Value, value) >= q.Threshold
 	default:
 		return false
 	}
 }
 
-func (n *Node) matchQuery(query *query) bool {
-	if query.name != "" && n.Name != query.name {
-		return false
-	}
-	if query.queryList == nil {
-		return query.name == n.Name
-	}
-	var isMatch bool
-	for _, qList := range query.queryList {
+func (n *Node) matchQList(queryList [][]Predicate) bool {
+	for _, qList := range queryList {
 		subMatch := true
 		for _, q := range qList {
 			if !n.matchQ(q) {
 				subMatch = false
+				break
 			}
 		}
 		if subMatch {
-			isMatch = true
-			break
+			return true
 		}
 	}
-	return isMatch
+	return false
 }
 
-func (n *Node) findNodes(query *query, parentMatched bool) []*Node {
-	currentMatch := make([]*Node, 0, 32)
-	for _, child := range n.Children {
-		if child.matchQuery(query) {
-			if query.next != nil {
-				subMatchList := child.findNodes(query.next, true)
-				if subMatchList != nil {
-					currentMatch = append(currentMatch, subMatchList...)
-				}
-			} else {
-				currentMatch = append(currentMatch, child)
-				subMatchList := child.findNodes(query, false)
-				if subMatchList != nil {
-					currentMatch = append(currentMatch, subMatchList...)
-				}
-			}
-		} else {
-			if !parentMatched {
-				subMatchList := child.findNodes(query, false)
-				if subMatchList != nil {
-					currentMatch = append(currentMatch, subMatchList...)
-				}
-			}
-		}
+func (n *Node) attrValue(name string) (string, bool) {
+	if f, ok := pseudoAttrs[name]; ok {
+		return f(n), true
 	}
-	if len(currentMatch) == 0 {
-		return nil
+	attr, ok := n.AttrMap[name]
+	return attr, ok
+}
+
+func (n *Node) matchQuery(query *Query) bool {
+	if n.Name == "" {
+		return false
+	}
+	if len(query.Names) > 0 && !query.matchName(n.Name) {
+		return false
+	}
+	if query.Predicates != nil && !n.matchQList(query.Predicates) {
+		return false
 	}
-	return currentMatch
+	for _, p := range query.Pseudos {
+		if !n.matchPseudo(p) {
+			return false
+		}
+	}
+	return true
 }
 
 func FindAll(node *Node, queryStr string) ([]*Node, error) {
-	query, err := parseQuery(queryStr)
-	if err != nil {
-		return nil, err
-	}
-	return node.findNodes(query, false), nil
+	return node.FindAll(queryStr)
 }
 
 // func process(ep *elemProcessor) (*Node, error) {
@@ -361,8 +348,12 @@ func genNode(n *html.Node, parent *Node) *Node {
 		parent.Content += n.Data
 		return nil
 	}
+	name := n.DataAtom.String()
+	if name == "" && n.Type == html.ElementNode {
+		name = n.Data
+	}
 	node := &Node{
-		Name:    n.DataAtom.String(),
+		Name:    name,
 		AttrMap: genAttrMap(n.Attr),
 		// Content:  n.Data,
 		Parent:   parent,
@@ -390,70 +381,81 @@ func genSibling(n *Node) {
 	}
 }
 
+// FindAll returns the descendants of n matching queryStr. Every node is
+// tested once against all queries of a union while n is walked in pre-order,
+// so the result is in document order and holds no duplicates.
 func (n *Node) FindAll(queryStr string) ([]*Node, error) {
-	query, err := parseQuery(queryStr)
+	sel, err := Compile(queryStr)
 	if err != nil {
 		return nil, err
 	}
-	chanList := []chan *Node{n.allChildren()}
-	for {
-		chanList = append(chanList, filter(chanList[len(chanList)-1], query))
-		if query.next == nil {
-			break
-		} else {
-			chanList = append(chanList, bridgeFilter(chanList[len(chanList)-1]))
-			query = query.next
-		}
+	return sel.FindAll(n), nil
+}
+
+// FindAllArgs is the same as FindAll with the placeholders of the query bound
+// to args, see CompileArgs. Bound values are taken literally, quote them with
+// QuoteRegexp when they are used with %=.
+func (n *Node) FindAllArgs(queryStr string, args map[string]string) ([]*Node, error) {
+	sel, err := CompileArgs(queryStr, args)
+	if err != nil {
+		return nil, err
 	}
-	nodeList := make([]*Node, 0, 128)
-	for node := range chanList[len(chanList)-1] {
-		nodeList = append(nodeList, node)
+	return sel.FindAll(n), nil
+}
+
+// QuoteRegexp escapes all regular expression metacharacters in s, so a bound
+// %= value matches s literally.
+func QuoteRegexp(s string) string {
+	return regexp.QuoteMeta(s)
+}
+
+// Iter is the same as FindAll but yields the nodes one by one, breaking out of
+// the loop stops the search.
+func (n *Node) Iter(queryStr string) (iter.Seq[*Node], error) {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, err
 	}
-	return nodeList, nil
+	return sel.Iter(n), nil
 }
 
-func (n *Node) allChildren() chan *Node {
-	childChan := make(chan *Node)
-	go func() {
-		for _, child := range n.Children {
-			childChan <- child
-			subChan := child.allChildren()
-			for subChild := range subChan {
-				childChan <- subChild
-			}
-		}
-		close(childChan)
-	}()
-	return childChan
+// FindFirst returns the first node matched by the query in document order, or
+// nil if there is none.
+func (n *Node) FindFirst(queryStr string) (*Node, error) {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	return sel.FindFirst(n), nil
 }
 
-func filter(input chan *Node, query *query) chan *Node {
-	outChan := make(chan *Node)
-	go func() {
-		for node := range input {
-			if node.matchQuery(query) {
-				outChan <- node
-			}
-		}
-		close(outChan)
-	}()
-	return outChan
+// FindValues runs a query ending with a projection and returns the projected
+// values in document order. Nodes without the projected attribute are skipped.
+func (n *Node) FindValues(queryStr string) ([]string, error) {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	return sel.FindValues(n)
 }
 
-func bridgeFilter(input chan *Node) chan *Node {
-	outChan := make(chan *Node)
-	go func() {
-		for n := range input {
-			for _, child := range n.Children {
-				outChan <- child
-			}
+// descendants yields the nodes under n in document order.
+func (n *Node) descendants() iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		n.walkDescendants(yield)
+	}
+}
+
+func (n *Node) walkDescendants(yield func(*Node) bool) bool {
+	for _, child := range n.Children {
+		if !yield(child) || !child.walkDescendants(yield) {
+			return false
 		}
-		close(outChan)
-	}()
-	return outChan
+	}
+	return true
 }
 
-// func (n *Node) rMatch(query *query) chan *Node {
+// func (n *Node) rMatch(query *Query) chan *Node {
 // 	matchChan := make(chan *Node)
 // 	var wg sync.WaitGroup
 // 	for _, child := range n.Children {
@@ -477,18 +479,49 @@ func bridgeFilter(input chan *Node) chan *Node {
 // 	return matchChan
 // }
 
-func (n *Node) matchParent(query *query) bool {
-	if query.prev == nil {
-		return true
-	}
-	if n.Parent == nil {
+func (n *Node) matchChain(query *Query, root *Node) bool {
+	if !n.matchQuery(query) {
 		return false
 	}
-	if !n.Parent.matchQuery(query.prev) {
+	return n.matchPrev(query, root)
+}
+
+func (n *Node) matchPrev(query *Query, root *Node) bool {
+	switch query.Combinator {
+	case Child:
+		if query.Prev == nil {
+			return n.Parent == root
+		}
+		return n.Parent != nil && n.Parent != root && n.Parent.matchChain(query.Prev, root)
+	case Adjacent:
+		prev := n.prevElement()
+		return prev != nil && prev.matchChain(query.Prev, root)
+	case Sibling:
+		for prev := n.prevElement(); prev != nil; prev = prev.prevElement() {
+			if prev.matchChain(query.Prev, root) {
+				return true
+			}
+		}
 		return false
-	} else {
-		return n.Parent.matchParent(query.prev)
+	default:
+		if query.Prev == nil {
+			return true
+		}
+		for p := n.Parent; p != nil && p != root; p = p.Parent {
+			if p.matchChain(query.Prev, root) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (n *Node) prevElement() *Node {
+	prev := n.Previous
+	for prev != nil && prev.Name == "" {
+		prev = prev.Previous
 	}
+	return prev
 }
 
 func (n *Node) GetAllContent() string {
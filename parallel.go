@@ -0,0 +1,141 @@
+package nbsoup
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// chunkSize is the number of candidates a worker checks before it looks at
+// the context and takes the next chunk.
+const chunkSize = 256
+
+// BatchMatch is a node found by FindAllBatch, Doc is the index of its
+// document in the roots.
+type BatchMatch struct {
+	Doc  int
+	Node *Node
+}
+
+type chunk struct {
+	doc   int
+	root  *Node
+	nodes []*Node
+}
+
+// FindAllParallel is the same as FindAll but checks the nodes with up to
+// workers goroutines, GOMAXPROCS if workers is not positive. The result is in
+// document order. Predicate functions must be safe for concurrent use.
+func (n *Node) FindAllParallel(ctx context.Context, queryStr string, workers int) ([]*Node, error) {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	return sel.FindAllParallel(ctx, n, workers)
+}
+
+// FindAllBatch runs the query on every root with up to workers goroutines
+// and returns the nodes tagged with the index of their document, ordered by
+// document and then document order.
+func FindAllBatch(ctx context.Context, roots []*Node, queryStr string, workers int) ([]BatchMatch, error) {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	return sel.FindAllBatch(ctx, roots, workers)
+}
+
+// FindAllParallel is the same as Node.FindAllParallel with a compiled query.
+func (s *Selector) FindAllParallel(ctx context.Context, n *Node, workers int) ([]*Node, error) {
+	results, err := s.run(ctx, s.split(0, n), workers)
+	if err != nil {
+		return nil, err
+	}
+	var nodeList []*Node
+	for _, l := range results {
+		nodeList = append(nodeList, l...)
+	}
+	return nodeList, nil
+}
+
+// FindAllBatch is the same as the package FindAllBatch with a compiled query.
+func (s *Selector) FindAllBatch(ctx context.Context, roots []*Node, workers int) ([]BatchMatch, error) {
+	var chunks []chunk
+	for i, root := range roots {
+		chunks = append(chunks, s.split(i, root)...)
+	}
+	results, err := s.run(ctx, chunks, workers)
+	if err != nil {
+		return nil, err
+	}
+	var matches []BatchMatch
+	for i, l := range results {
+		for _, node := range l {
+			matches = append(matches, BatchMatch{chunks[i].doc, node})
+		}
+	}
+	return matches, nil
+}
+
+// split cuts the candidates under root into chunks in document order. The
+// index, if the document uses one, is built here before the workers start.
+func (s *Selector) split(doc int, root *Node) []chunk {
+	candidates, ok := s.candidates(root)
+	if !ok {
+		candidates = slices.Collect(root.descendants())
+	}
+	chunks := make([]chunk, 0, len(candidates)/chunkSize+1)
+	for nodes := range slices.Chunk(candidates, chunkSize) {
+		chunks = append(chunks, chunk{doc, root, nodes})
+	}
+	return chunks
+}
+
+// run checks the chunks with a bounded pool of workers, the matches of
+// chunks[i] are in results[i].
+func (s *Selector) run(ctx context.Context, chunks []chunk, workers int) ([][]*Node, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = max(min(workers, len(chunks)), 1)
+	results := make([][]*Node, len(chunks))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				c := chunks[i]
+				for _, node := range c.nodes {
+					if s.union.match(node, c.root) {
+						results[i] = append(results[i], node)
+					}
+				}
+			}
+		}()
+	}
+	var err error
+	for i := range chunks {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
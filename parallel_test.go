@@ -0,0 +1,77 @@
+package nbsoup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestFindAllParallel(t *testing.T) {
+	b, err := os.ReadFile("test.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, queryStr := range []string{`td`, `tr > td[@content*="a"]`, `font:has(b), img`} {
+		want, _ := root.FindAll(queryStr)
+		for _, workers := range []int{0, 1, 3} {
+			got, err := root.FindAllParallel(context.Background(), queryStr, workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("%s: got %d nodes, want %d", queryStr, len(got), len(want))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("%s: node %d differs", queryStr, i)
+				}
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := root.FindAllParallel(ctx, `td`, 2); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestFindAllBatch(t *testing.T) {
+	var roots []*Node
+	for _, s := range []string{`<ul><li>a</li><li>b</li></ul>`, `<p>none</p>`, `<li>c</li>`} {
+		root, err := Parse([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	matches, err := FindAllBatch(context.Background(), roots, `li`, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BatchMatch{{0, nil}, {0, nil}, {2, nil}}
+	if len(matches) != len(want) {
+		t.Fatalf("got %v", matches)
+	}
+	for i, m := range matches {
+		if m.Doc != want[i].Doc || m.Node.Name != "li" {
+			t.Fatalf("got %v", matches)
+		}
+	}
+	if matches[1].Node.Content != "b" {
+		t.Fatalf("got %q", matches[1].Node.Content)
+	}
+}
+
+func BenchmarkFindAllParallel(b *testing.B) {
+	root := benchDoc(b)
+	sel := MustCompile(`div:has(a[@content="link"]) > span[@content%="7$"]`)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sel.FindAllParallel(context.Background(), root, 0)
+	}
+}
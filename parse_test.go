@@ -3,7 +3,6 @@ package nbsoup
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	_ "net/http/pprof"
 	"os"
 	"testing"
@@ -12,10 +11,13 @@ import (
 func TestParse(t *testing.T) {
 	f, err := os.Open("test.html")
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
 	defer f.Close()
-	b, _ := ioutil.ReadAll(f)
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
 	// html, err := ioutil.ReadAll(f)
 	// if err != nil {
 	// 	log.Fatal(err)
@@ -41,16 +43,27 @@ func TestParse(t *testing.T) {
 	// }
 	root, err := Parse(b)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
+	}
+	tables, err := root.FindAll(`table:has(> tbody > tr > td > p > font[@content*="Make Model"])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0].AttrMap["id"] != "table25" {
+		t.Fatalf("got %d tables, want table25", len(tables))
 	}
-	makeModel, _ := root.FindAll(`font[@content*="Make Model"]`)
-	table := makeModel[0]
-	for table != nil && table.Name != "table" {
-		table = table.Parent
+	trs, err := tables[0].FindAll(`tr`)
+	if err != nil {
+		t.Fatal(err)
 	}
-	trs, _ := table.FindAll(`tr`)
 	for _, tr := range trs {
-		tds, _ := tr.FindAll(`td`)
+		tds, err := tr.FindAll(`td`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tds) != 2 {
+			t.Fatalf("got %d cells, want 2", len(tds))
+		}
 		fmt.Printf("%v:%v\n", tds[0].GetAllContent(), tds[1].GetAllContent())
 	}
 }
@@ -0,0 +1,129 @@
+package nbsoup
+
+import (
+	"strconv"
+	"strings"
+)
+
+var operatorNames = func() map[Operator]string {
+	m := make(map[Operator]string, len(operatorMap))
+	for name, op := range operatorMap {
+		m[op] = name
+	}
+	return m
+}()
+
+var combinatorNames = map[Combinator]string{
+	Descendant: " ",
+	Child:      " > ",
+	Adjacent:   " + ",
+	Sibling:    " ~ ",
+}
+
+func quoteValue(s string) string {
+	if strings.Contains(s, `\`) && !strings.Contains(s, `"`) {
+		return `r"` + s + `"`
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (q Predicate) String() string {
+	if !strings.HasPrefix(q.Attr, ":") {
+		s := q.Attr + operatorNames[q.Operator] + quoteValue(q.Value)
+		if q.Operator == Fuzzy && q.Threshold != defaultThreshold {
+			s += " " + strconv.FormatFloat(q.Threshold, 'f', -1, 64)
+		}
+		return s
+	}
+	var b strings.Builder
+	if q.Negate {
+		b.WriteString("!")
+	}
+	b.WriteString(q.Attr + "(")
+	for i, arg := range q.Args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteValue(arg))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func (p Pseudo) String() string {
+	switch pseudoArgs[p.Name] {
+	case intArg:
+		return ":" + p.Name + "(" + strconv.Itoa(p.Arg) + ")"
+	case queryArg:
+		return ":" + p.Name + "(" + p.sub.String() + ")"
+	default:
+		return ":" + p.Name
+	}
+}
+
+// elemString prints a single query element without its combinator.
+func (query *Query) elemString() string {
+	var b strings.Builder
+	b.WriteString(strings.Join(query.Names, "|"))
+	if query.Predicates != nil {
+		b.WriteString("[")
+		for i, qList := range query.Predicates {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			for j, q := range qList {
+				if j > 0 {
+					b.WriteString(" & ")
+				}
+				b.WriteString(q.String())
+			}
+		}
+		b.WriteString("]")
+	}
+	for _, p := range query.Pseudos {
+		b.WriteString(p.String())
+	}
+	if b.Len() == 0 {
+		return "*"
+	}
+	return b.String()
+}
+
+// chainString prints the chain ending with last.
+func (last *Query) chainString() string {
+	first := last.first()
+	var b strings.Builder
+	if first.Combinator == Child {
+		b.WriteString("> ")
+	}
+	for elem := first; elem != nil; elem = elem.Next {
+		if elem != first {
+			b.WriteString(combinatorNames[elem.Combinator])
+		}
+		b.WriteString(elem.elemString())
+		if elem == last {
+			break
+		}
+	}
+	if last.Projection != "" {
+		b.WriteString("/" + projectionString(last.Projection))
+	}
+	return b.String()
+}
+
+func (u union) String() string {
+	l := make([]string, 0, len(u))
+	for _, query := range u {
+		l = append(l, query.chainString())
+	}
+	return strings.Join(l, ", ")
+}
+
+func projectionString(attr string) string {
+	for name, pseudo := range projectionFuncs {
+		if pseudo == attr {
+			return name + "()"
+		}
+	}
+	return "@" + attr
+}
@@ -0,0 +1,159 @@
+package nbsoup
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPseudoClass = errors.New("invalid pseudo class")
+
+var pseudoAttrs = map[string]func(n *Node) string{
+	"@content": func(n *Node) string {
+		return n.Content
+	},
+	"@text": func(n *Node) string {
+		return n.GetAllContent()
+	},
+	"@owntext": func(n *Node) string {
+		return strings.Trim(n.Content, " ")
+	},
+	"@name": func(n *Node) string {
+		return n.Name
+	},
+	"@html": func(n *Node) string {
+		return n.innerHTML()
+	},
+	"@index": func(n *Node) string {
+		return strconv.Itoa(n.elementIndex() + 1)
+	},
+	"@depth": func(n *Node) string {
+		return strconv.Itoa(n.depth())
+	},
+	"@childcount": func(n *Node) string {
+		return strconv.Itoa(len(n.elementChildren()))
+	},
+	"@empty": func(n *Node) string {
+		return strconv.FormatBool(len(n.Children) == 0 && strings.TrimSpace(n.Content) == "")
+	},
+}
+
+// Pseudo is a pseudo-class like :first or :has(...).
+type Pseudo struct {
+	Name string
+	Arg  int
+	sub  union
+}
+
+type pseudoArg int
+
+const (
+	noArg pseudoArg = iota
+	intArg
+	queryArg
+)
+
+var pseudoArgs = map[string]pseudoArg{
+	"first":        noArg,
+	"last":         noArg,
+	"odd":          noArg,
+	"even":         noArg,
+	"nth":          intArg,
+	"nth-of-type":  intArg,
+	"has":          queryArg,
+	"has-ancestor": queryArg,
+	"has-sibling":  queryArg,
+}
+
+func (n *Node) matchPseudo(p Pseudo) bool {
+	switch p.Name {
+	case "first":
+		return n.elementIndex() == 0
+	case "last":
+		return n.elementIndex() == len(n.elementSiblings())-1
+	case "odd":
+		return n.elementIndex()%2 == 0
+	case "even":
+		return n.elementIndex()%2 == 1
+	case "nth":
+		return matchPosition(n.elementSiblings(), n, p.Arg)
+	case "nth-of-type":
+		l := make([]*Node, 0, 16)
+		for _, sibling := range n.elementSiblings() {
+			if sibling.Name == n.Name {
+				l = append(l, sibling)
+			}
+		}
+		return matchPosition(l, n, p.Arg)
+	case "has":
+		return n.hasDescendant(n, p.sub)
+	case "has-ancestor":
+		root := n.Root()
+		for a := n.Parent; a != nil; a = a.Parent {
+			if p.sub.match(a, root) {
+				return true
+			}
+		}
+		return false
+	case "has-sibling":
+		root := n.Root()
+		for _, sibling := range n.elementSiblings() {
+			if sibling != n && p.sub.match(sibling, root) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func matchPosition(l []*Node, n *Node, pos int) bool {
+	if pos < 0 {
+		pos += len(l) + 1
+	}
+	return pos >= 1 && pos <= len(l) && l[pos-1] == n
+}
+
+func (n *Node) elementChildren() []*Node {
+	l := make([]*Node, 0, len(n.Children))
+	for _, child := range n.Children {
+		if child.Name != "" {
+			l = append(l, child)
+		}
+	}
+	return l
+}
+
+func (n *Node) elementSiblings() []*Node {
+	if n.Parent == nil {
+		return []*Node{n}
+	}
+	return n.Parent.elementChildren()
+}
+
+func (n *Node) elementIndex() int {
+	for i, sibling := range n.elementSiblings() {
+		if sibling == n {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *Node) hasDescendant(root *Node, sel union) bool {
+	for _, child := range n.Children {
+		if sel.match(child, root) || child.hasDescendant(root, sel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Node) depth() int {
+	var d int
+	for p := n.Parent; p != nil; p = p.Parent {
+		d++
+	}
+	return d
+}
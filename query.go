@@ -2,27 +2,58 @@ package nbsoup
 
 import (
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
-type queryOperator int
+type Operator int
 
 const (
-	equal queryOperator = iota
-	notEqual
-	include
-	except
-	reg
+	Equal Operator = iota
+	NotEqual
+	Contains
+	NotContains
+	Regexp
+	Less
+	LessEqual
+	Greater
+	GreaterEqual
+	Between
+	Fuzzy
 )
 
-var operatorMap = map[string]queryOperator{
-	"=":   equal,
-	"!=":  notEqual,
-	"*=":  include,
-	"!*=": except,
-	"%=":  reg,
+var operatorMap = map[string]Operator{
+	"=":   Equal,
+	"!=":  NotEqual,
+	"*=":  Contains,
+	"!*=": NotContains,
+	"%=":  Regexp,
+	"<":   Less,
+	"<=":  LessEqual,
+	">":   Greater,
+	">=":  GreaterEqual,
+	"<>":  Between,
+	"~~=": Fuzzy,
+}
+
+type Combinator int
+
+const (
+	Descendant Combinator = iota
+	Child
+	Adjacent
+	Sibling
+)
+
+var combinatorMap = map[string]Combinator{
+	".":  Child,
+	">":  Child,
+	"..": Descendant,
+	"+":  Adjacent,
+	"~":  Sibling,
 }
 
 type queryRelation int
@@ -37,236 +68,492 @@ var ErrNoValidQuery = errors.New("no valid query in query string")
 var ErrInvalidAttrName = errors.New("invalid attribute name")
 var ErrInvalidOperator = errors.New("invalid operator")
 var ErrInvalidCharacter = errors.New("invalid character")
+var ErrInvalidCombinator = errors.New("invalid combinator")
+var ErrInvalidProjection = errors.New("invalid projection")
+var ErrNoProjection = errors.New("query has no projection")
+var ErrUnboundPlaceholder = errors.New("no value bound to placeholder")
 
-var qRe = regexp.MustCompile(`(\w*)\[(.*?)\]`)
+// Query is one element of a parsed query chain. Predicates are OR-ed groups of
+// AND-ed predicates, Combinator relates the element to Prev and Projection is
+// only set on the last element of a chain.
+type Query struct {
+	Names      []string
+	Predicates [][]Predicate
+	Pseudos    []Pseudo
+	Combinator Combinator
+	Projection string
+	Next       *Query
+	Prev       *Query
+}
 
-type query struct {
-	name      string
-	queryList [][]q
-	next      *query
-	prev      *query
+// Predicate is a single attribute test. Function predicates have Attr set to
+// ":" followed by the function name.
+type Predicate struct {
+	Attr      string
+	Operator  Operator
+	Value     string
+	Threshold float64
+	Args      []string
+	Negate    bool
+	re        *regexp.Regexp
+	kind      valueKind
+	min       float64
+	max       float64
+	fn        PredicateFunc
 }
 
-type q struct {
-	name     string
-	operator queryOperator
-	value    string
+type parser struct {
+	tokens []token
+	pos    int
+	args   map[string]string
+	nArgs  int
+}
+
+type union []*Query
+
+func parseUnion(s string) (union, error) {
+	return parseUnionArgs(s, nil)
 }
 
-func parseQuery(s string) (*query, error) {
+// parseUnionArgs parses s binding $name placeholders to args[name] and the
+// n-th ? placeholder to args["n"].
+func parseUnionArgs(s string, args map[string]string) (union, error) {
 	s = strings.Trim(s, " \t")
 	if s == "" {
 		return nil, ErrEmptyQuery
 	}
-	queryElem := ""
-	reader := strings.NewReader(s)
-	var inQuote bool
-OUTER:
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, args: args}
+	sel, err := p.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, ErrInvalidCharacter
+	}
+	return sel, nil
+}
+
+func (p *parser) parseUnion() (union, error) {
+	sel := make(union, 0, 4)
 	for {
-		r, _, err := reader.ReadRune()
+		head, err := p.parseChain()
 		if err != nil {
-			break
+			return nil, err
 		}
-		switch r {
-		case '"':
-			inQuote = !inQuote
-			queryElem += string(r)
-		case '.':
-			if inQuote {
-				queryElem += string(r)
-				continue
+		last := head.last()
+		if p.peek().kind == tokSlash {
+			p.next()
+			if last.Projection, err = p.parseProjection(); err != nil {
+				return nil, err
 			}
-			break OUTER
-		default:
-			queryElem += string(r)
+			p.skipSpace()
 		}
+		sel = append(sel, last)
+		if p.peek().kind != tokComma {
+			return sel, nil
+		}
+		p.next()
+	}
+}
+
+func (query *Query) last() *Query {
+	for query.Next != nil {
+		query = query.Next
 	}
-	if queryElem == "" {
-		return nil, ErrNoValidQuery
+	return query
+}
+
+func (query *Query) first() *Query {
+	for query.Prev != nil {
+		query = query.Prev
 	}
-	subReader := strings.NewReader(queryElem)
-	var name string
-	var attrs string
-	var inAttrs bool
-SUB:
+	return query
+}
+
+func (query *Query) matchName(name string) bool {
+	for _, pattern := range query.Names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s union) match(n *Node, root *Node) bool {
+	for _, query := range s {
+		if n.matchChain(query, root) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) skipSpace() bool {
+	var skipped bool
+	for p.peek().kind == tokSpace {
+		p.next()
+		skipped = true
+	}
+	return skipped
+}
+
+func (p *parser) parseChain() (*Query, error) {
+	p.skipSpace()
+	comb := Descendant
+	explicit := false
+	if t := p.peek(); t.kind == tokCombinator {
+		p.next()
+		comb = combinatorMap[t.value]
+		explicit = true
+		if comb == Adjacent || comb == Sibling {
+			return nil, ErrInvalidCombinator
+		}
+		p.skipSpace()
+	}
+	var head, tail *Query
 	for {
-		r, _, err := subReader.ReadRune()
+		thisQuery, err := p.parseQueryElem()
 		if err != nil {
-			break
+			return nil, err
 		}
-		switch r {
-		case '[':
-			inAttrs = true
-		case ']':
-			break SUB
-		default:
-			if inAttrs {
-				attrs += string(r)
-			} else {
-				name += string(r)
+		if thisQuery == nil {
+			if explicit {
+				return nil, ErrInvalidCombinator
 			}
+			return nil, ErrNoValidQuery
+		}
+		thisQuery.Combinator = comb
+		if head == nil {
+			head = thisQuery
+		} else {
+			tail.Next = thisQuery
+			thisQuery.Prev = tail
+		}
+		tail = thisQuery
+		spaced := p.skipSpace()
+		switch t := p.peek(); {
+		case t.kind == tokCombinator:
+			p.next()
+			comb = combinatorMap[t.value]
+			explicit = true
+			p.skipSpace()
+		case t.kind == tokEOF || t.kind == tokRParen || t.kind == tokComma || t.kind == tokSlash:
+			return head, nil
+		case spaced:
+			comb = Descendant
+			explicit = false
+		default:
+			return nil, ErrInvalidCharacter
 		}
 	}
-	qList, err := parseQ(attrs)
-	if err != nil {
-		return nil, err
+}
+
+func (p *parser) parseQueryElem() (*Query, error) {
+	var thisQuery Query
+	var found bool
+	for p.peek().kind == tokIdent {
+		thisQuery.Names = append(thisQuery.Names, p.next().value)
+		found = true
+		if p.peek().kind != tokOr {
+			break
+		}
+		p.next()
+		if p.peek().kind != tokIdent {
+			return nil, ErrInvalidCharacter
+		}
 	}
-	thisQuery := query{name: name, queryList: qList}
-	if reader.Len() > 0 {
-		bRemain, _ := ioutil.ReadAll(reader)
-		nextQuery, err := parseQuery(string(bRemain))
+	if p.peek().kind == tokLBracket {
+		p.next()
+		qList, err := p.parseQ()
 		if err != nil {
 			return nil, err
 		}
-		thisQuery.next = nextQuery
-		nextQuery.prev = &thisQuery
+		thisQuery.Predicates = qList
+		found = true
+	}
+	for p.peek().kind == tokColon {
+		p.next()
+		pseudo, err := p.parsePseudoClass()
+		if err != nil {
+			return nil, err
+		}
+		thisQuery.Pseudos = append(thisQuery.Pseudos, pseudo)
+		found = true
+	}
+	if !found {
+		return nil, nil
 	}
 	return &thisQuery, nil
 }
 
-type attributePosition int
-
-const (
-	posName attributePosition = iota
-	posOperator
-	posValue
-	posFinish
-)
-
-func parseQ(s string) ([][]q, error) {
-	s = strings.Trim(s, " \t")
-	if s == "" {
+func (p *parser) parseQ() ([][]Predicate, error) {
+	if p.peek().kind == tokRBracket {
+		p.next()
 		return nil, nil
 	}
-	reader := strings.NewReader(s)
-	queryList := make([][]q, 0, 16)
-	var attrName string
-	var operator string
-	var value string
-	var relation queryRelation
-	var pos attributePosition
+	queryList := make([][]Predicate, 0, 16)
+	relation := or
 	for {
-		r, _, err := reader.ReadRune()
+		thisQ, err := p.parsePredicate()
 		if err != nil {
-			if ok := checkName(attrName); !ok {
-				return nil, ErrInvalidAttrName
-			}
-			if ok := checkOperator(operator); !ok {
-				return nil, ErrInvalidOperator
-			}
-			op := operatorMap[operator]
-			if op == reg {
-				_, err := regexp.Compile(value)
-				if err != nil {
-					return nil, err
-				}
-			}
-			thisQ := q{name: attrName, operator: op, value: value}
-			if len(queryList) == 0 {
-				qList := []q{thisQ}
-				queryList = append(queryList, qList)
-			} else {
-				if relation == and {
-					index := len(queryList) - 1
-					queryList[index] = append(queryList[index], thisQ)
-				} else {
-					qList := []q{thisQ}
-					queryList = append(queryList, qList)
-				}
-			}
+			return nil, err
+		}
+		if relation == and {
+			index := len(queryList) - 1
+			queryList[index] = append(queryList[index], thisQ)
+		} else {
+			queryList = append(queryList, []Predicate{thisQ})
+		}
+		switch p.next().kind {
+		case tokRBracket:
 			return queryList, nil
+		case tokAnd:
+			relation = and
+		case tokOr:
+			relation = or
+		default:
+			return nil, ErrInvalidCharacter
 		}
-		switch r {
-		case ' ':
-			if pos == posValue {
-				value += string(r)
-			}
-			continue
-		case '=', '!', '*', '%':
-			switch pos {
-			case posName:
-				pos = posOperator
-				operator += string(r)
-			case posOperator:
-				operator += string(r)
-			case posValue:
-				value += string(r)
-			case posFinish:
-				return nil, ErrInvalidCharacter
-			}
-		case '"':
-			switch pos {
-			case posName:
-				return nil, ErrInvalidAttrName
-			case posOperator:
-				pos = posValue
-			case posValue:
-				pos = posFinish
-			case posFinish:
-				return nil, ErrInvalidCharacter
-			}
-		case '&', '|':
-			switch pos {
-			case posName:
-				return nil, ErrInvalidAttrName
-			case posOperator:
-				return nil, ErrInvalidOperator
-			case posValue:
-				value += string(r)
-			case posFinish:
-				if ok := checkName(attrName); !ok {
-					return nil, ErrInvalidAttrName
-				}
-				if ok := checkOperator(operator); !ok {
-					return nil, ErrInvalidOperator
-				}
-				op := operatorMap[operator]
-				if op == reg {
-					if _, err := regexp.Compile(value); err != nil {
-						return nil, err
-					}
-				}
-				thisQ := q{name: attrName, operator: op, value: value}
-				if len(queryList) == 0 {
-					qList := []q{thisQ}
-					queryList = append(queryList, qList)
-				} else {
-					if relation == and {
-						index := len(queryList) - 1
-						queryList[index] = append(queryList[index], thisQ)
-					} else {
-						qList := []q{thisQ}
-						queryList = append(queryList, qList)
-					}
-				}
-				attrName = ""
-				operator = ""
-				value = ""
-				pos = posName
-				if string(r) == "&" {
-					relation = and
-				} else {
-					relation = or
-				}
-			}
+	}
+}
+
+func (p *parser) parsePredicate() (Predicate, error) {
+	if t := p.peek(); t.kind == tokColon || t.kind == tokOperator && t.value == "!" {
+		return p.parseFuncCall()
+	}
+	name := p.next()
+	if name.kind != tokIdent {
+		return Predicate{}, ErrInvalidAttrName
+	}
+	operator := p.next()
+	if operator.kind != tokOperator {
+		return Predicate{}, ErrInvalidOperator
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return Predicate{}, err
+	}
+	thisQ, err := newQ(name.value, operator.value, value)
+	if err != nil || thisQ.Operator != Fuzzy {
+		return thisQ, err
+	}
+	thisQ.Threshold = defaultThreshold
+	if p.peek().kind == tokNumber {
+		threshold, err := strconv.ParseFloat(p.next().value, 64)
+		if err != nil || threshold < 0 || threshold > 1 {
+			return Predicate{}, ErrInvalidThreshold
+		}
+		thisQ.Threshold = threshold
+	}
+	return thisQ, nil
+}
+
+func (p *parser) parseFuncCall() (Predicate, error) {
+	var thisQ Predicate
+	if p.peek().kind == tokOperator {
+		p.next()
+		thisQ.Negate = true
+	}
+	if p.next().kind != tokColon {
+		return Predicate{}, ErrInvalidCharacter
+	}
+	name := p.next()
+	if name.kind != tokIdent {
+		return Predicate{}, ErrInvalidFuncName
+	}
+	fn, ok := lookupFunc(name.value)
+	if !ok {
+		return Predicate{}, fmt.Errorf("%w: %s", ErrUnknownFunc, name.value)
+	}
+	thisQ.Attr, thisQ.fn = ":"+name.value, fn
+	if p.peek().kind != tokLParen {
+		return thisQ, nil
+	}
+	p.next()
+	if p.peek().kind == tokRParen {
+		p.next()
+		return thisQ, nil
+	}
+	for {
+		arg, err := p.parseValue()
+		if err != nil {
+			return Predicate{}, err
+		}
+		thisQ.Args = append(thisQ.Args, arg)
+		switch p.next().kind {
+		case tokRParen:
+			return thisQ, nil
+		case tokComma:
 		default:
-			switch pos {
-			case posName:
-				attrName += string(r)
-			case posOperator:
-				return nil, ErrInvalidOperator
-			case posValue:
-				value += string(r)
-			case posFinish:
-				return nil, ErrInvalidCharacter
+			return Predicate{}, ErrInvalidCharacter
+		}
+	}
+}
+
+// parseValue reads a quoted value or binds a placeholder. Bound values are
+// used as they are and never parsed as query text.
+func (p *parser) parseValue() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return t.value, nil
+	case tokPlaceholder:
+		name := t.value
+		if name == "" {
+			p.nArgs++
+			name = strconv.Itoa(p.nArgs)
+		}
+		value, ok := p.args[name]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnboundPlaceholder, name)
+		}
+		return value, nil
+	default:
+		return "", ErrInvalidCharacter
+	}
+}
+
+var projectionFuncs = map[string]string{
+	"content": "@content",
+	"text":    "@text",
+	"owntext": "@owntext",
+	"html":    "@html",
+	"name":    "@name",
+}
+
+func (p *parser) parseProjection() (string, error) {
+	p.skipSpace()
+	t := p.next()
+	if t.kind != tokIdent {
+		return "", ErrInvalidProjection
+	}
+	if attr, ok := strings.CutPrefix(t.value, "@"); ok {
+		if !nameCheckRe.MatchString(attr) {
+			return "", ErrInvalidProjection
+		}
+		return attr, nil
+	}
+	attr, ok := projectionFuncs[t.value]
+	if !ok || p.next().kind != tokLParen || p.next().kind != tokRParen {
+		return "", ErrInvalidProjection
+	}
+	return attr, nil
+}
+
+func (p *parser) parsePseudoClass() (Pseudo, error) {
+	name := p.next()
+	argType, ok := pseudoArgs[name.value]
+	if name.kind != tokIdent || !ok {
+		return Pseudo{}, ErrInvalidPseudoClass
+	}
+	pseudo := Pseudo{Name: name.value}
+	if argType == noArg {
+		if p.peek().kind == tokLParen {
+			return Pseudo{}, ErrInvalidPseudoClass
+		}
+		return pseudo, nil
+	}
+	if p.next().kind != tokLParen {
+		return Pseudo{}, ErrInvalidPseudoClass
+	}
+	p.skipSpace()
+	if argType == queryArg {
+		if p.peek().kind == tokRParen {
+			return Pseudo{}, ErrEmptyQuery
+		}
+		sub, err := p.parseUnion()
+		if err != nil {
+			return Pseudo{}, err
+		}
+		for _, query := range sub {
+			if query.Projection != "" {
+				return Pseudo{}, ErrInvalidProjection
 			}
 		}
+		pseudo.sub = sub
+	} else {
+		i, err := strconv.Atoi(p.next().value)
+		if err != nil || i == 0 {
+			return Pseudo{}, ErrInvalidPseudoClass
+		}
+		pseudo.Arg = i
+		p.skipSpace()
+	}
+	if p.next().kind != tokRParen {
+		return Pseudo{}, ErrInvalidPseudoClass
+	}
+	return pseudo, nil
+}
+
+func newQ(attrName, operator, value string) (Predicate, error) {
+	if ok := checkOperator(operator); !ok {
+		return Predicate{}, ErrInvalidOperator
+	}
+	thisQ := Predicate{Attr: attrName, Operator: operatorMap[operator], Value: value}
+	if err := thisQ.compile(); err != nil {
+		return Predicate{}, err
+	}
+	return thisQ, nil
+}
+
+// compile checks q and prepares the regular expression, the bounds or the
+// function it is matched with.
+func (q *Predicate) compile() error {
+	if name, ok := strings.CutPrefix(q.Attr, ":"); ok {
+		fn, ok := lookupFunc(name)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownFunc, name)
+		}
+		q.fn = fn
+		return nil
+	}
+	if ok := checkName(q.Attr); !ok {
+		return ErrInvalidAttrName
+	}
+	if _, ok := operatorNames[q.Operator]; !ok {
+		return ErrInvalidOperator
 	}
+	switch q.Operator {
+	case Regexp:
+		re, err := regexp.Compile(q.Value)
+		if err != nil {
+			return err
+		}
+		q.re = re
+	case Less, LessEqual, Greater, GreaterEqual, Between:
+		if err := q.parseBounds(); err != nil {
+			return err
+		}
+	case Fuzzy:
+		if q.Threshold < 0 || q.Threshold > 1 {
+			return ErrInvalidThreshold
+		}
+	}
+	return nil
 }
 
-var nameCheckRe = regexp.MustCompile(`^(\w+|@content)$`)
+var nameCheckRe = regexp.MustCompile(`^[\w-]+$`)
 
 func checkName(attrName string) bool {
+	if _, ok := pseudoAttrs[attrName]; ok || attrName == "@attrs" {
+		return true
+	}
 	return nameCheckRe.MatchString(attrName)
 }
 
@@ -0,0 +1,513 @@
+package nbsoup
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var queryTestHTML = []byte(`<html><body>
+<div id="app">
+	<ul class="list">
+		<li>one</li>
+		<li class="x">two</li>
+		<li>three</li>
+	</ul>
+	<p>para<span>inner</span></p>
+	<div class="nested"><p>deep</p></div>
+</div>
+</body></html>`)
+
+func names(nodes []*Node) []string {
+	l := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		l = append(l, n.Name+":"+n.GetAllContent())
+	}
+	return l
+}
+
+func checkFindAll(t *testing.T, root *Node, queryStr string, want ...string) {
+	t.Helper()
+	nodes, err := root.FindAll(queryStr)
+	if err != nil {
+		t.Fatalf("%s: %v", queryStr, err)
+	}
+	got := names(nodes)
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %q, want %q", queryStr, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got %q, want %q", queryStr, got, want)
+		}
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `div[id="app"] > p`, "p:para inner")
+	checkFindAll(t, root, `div[id="app"].p`, "p:para inner")
+	checkFindAll(t, root, `div[id="app"] p`, "p:para inner", "p:deep")
+	checkFindAll(t, root, `div[id="app"]..p`, "p:para inner", "p:deep")
+	checkFindAll(t, root, `li[class="x"] + li`, "li:three")
+	checkFindAll(t, root, `li ~ li`, "li:two", "li:three")
+	checkFindAll(t, root, `ul + p > span`, "span:inner")
+	nested, _ := root.FindAll(`div[class="nested"]`)
+	checkFindAll(t, nested[0], `> p`, "p:deep")
+	checkFindAll(t, nested[0], `span`)
+	for _, queryStr := range []string{`div >`, `div > > p`, `+ li`, `div ... p`} {
+		if _, err := root.FindAll(queryStr); err != ErrInvalidCombinator {
+			t.Errorf("%s: got %v, want %v", queryStr, err, ErrInvalidCombinator)
+		}
+	}
+	pkg, _ := FindAll(root, `div[id="app"] > p`)
+	if len(pkg) != 1 {
+		t.Errorf("package FindAll: got %d nodes, want 1", len(pkg))
+	}
+}
+
+func TestPositionalQuery(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `li:first`, "li:one")
+	checkFindAll(t, root, `li:last`, "li:three")
+	checkFindAll(t, root, `li:nth(2)`, "li:two")
+	checkFindAll(t, root, `li:nth(-1)`, "li:three")
+	checkFindAll(t, root, `li:odd`, "li:one", "li:three")
+	checkFindAll(t, root, `li:even`, "li:two")
+	checkFindAll(t, root, `div[id="app"] > p:nth-of-type(1)`, "p:para inner")
+	checkFindAll(t, root, `div[id="app"] > :nth(2)`, "p:para inner")
+	checkFindAll(t, root, `li[@index="2"]`, "li:two")
+	checkFindAll(t, root, `li[@index="0"]`)
+	checkFindAll(t, root, `ul[@childcount="3"]`, "ul:one two three")
+	checkFindAll(t, root, `div[@depth="4"]`, "div:deep")
+	checkFindAll(t, root, `span[@empty="true"]`)
+	blank, err := Parse([]byte("<div><b></b><i>x</i></div>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := blank.FindFirst(`b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Content = "\n\t"
+	checkFindAll(t, blank, `div > [@empty="true"]`, "b:\n\t")
+	checkFindAll(t, root, `li[class="x"]:first`)
+	for _, queryStr := range []string{`li:nth`, `li:nth(x)`, `li:first(1)`, `li:unknown`} {
+		if _, err := root.FindAll(queryStr); err != ErrInvalidPseudoClass {
+			t.Errorf("%s: got %v, want %v", queryStr, err, ErrInvalidPseudoClass)
+		}
+	}
+}
+
+func TestRelationalQuery(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `div:has(li[class="x"])`, "div:one two three para inner deep")
+	checkFindAll(t, root, `div:has(> p)`, "div:one two three para inner deep", "div:deep")
+	checkFindAll(t, root, `p:has-ancestor(div[class="nested"])`, "p:deep")
+	checkFindAll(t, root, `p:has-ancestor(body > div)`, "p:para inner", "p:deep")
+	checkFindAll(t, root, `li:has-sibling(li[class="x"])`, "li:one", "li:three")
+	checkFindAll(t, root, `li:has-sibling(ul[class="list"] > li[class="x"])`, "li:one", "li:three")
+	checkFindAll(t, root, `li:has-sibling(div li)`, "li:one", "li:two", "li:three")
+	checkFindAll(t, root, `li:has-sibling(body > li)`)
+	checkFindAll(t, root, `ul:has(span)`)
+	if _, err := root.FindAll(`div:has()`); err != ErrEmptyQuery {
+		t.Errorf("got %v, want %v", err, ErrEmptyQuery)
+	}
+}
+
+func TestPseudoAttrs(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `p[@text="para inner"]`, "p:para inner")
+	checkFindAll(t, root, `p[@content*="inner"]`)
+	checkFindAll(t, root, `p[@owntext="para"]`, "p:para inner")
+	checkFindAll(t, root, `div[id="app"] > [@name="p" | @name%="^u"]`, "ul:one two three", "p:para inner")
+	checkFindAll(t, root, `[@name!*="i" & @childcount="1"]`, "body:one two three para inner deep", "p:para inner")
+	checkFindAll(t, root, `p[@html="para<span>inner</span>"]`, "p:para inner")
+	checkFindAll(t, root, `[@attrs="x"]`, "li:two")
+	checkFindAll(t, root, `li[@attrs!="x"]`)
+	checkFindAll(t, root, `div[@attrs%="^n"]`, "div:deep")
+}
+
+func TestCompareQuery(t *testing.T) {
+	root, err := Parse([]byte(`<ul>
+<li date="2023-12-31">$99.50</li>
+<li date="2024-01-01">€1.234,50</li>
+<li date="2024-02-10T08:00:00Z">USD 2,500</li>
+<li>free</li>
+</ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `li[@content>"100"]`, "li:€1.234,50", "li:USD 2,500")
+	checkFindAll(t, root, `li[@content<="99.5"]`, "li:$99.50")
+	checkFindAll(t, root, `li[@content<>"1000..2000"]`, "li:€1.234,50")
+	checkFindAll(t, root, `li[date>="2024-01-01"]`, "li:€1.234,50", "li:USD 2,500")
+	checkFindAll(t, root, `li[date<"2024-01-01T00:00:00Z"]`, "li:$99.50")
+	checkFindAll(t, root, `li[@content>" $ 100 "]`, "li:€1.234,50", "li:USD 2,500")
+	for _, queryStr := range []string{`li[@content>"abc"]`, `li[@content>"abc1"]`, `li[@content>"12 to 15"]`, `li[@content<>"1..5x"]`, `li[@content>""]`} {
+		if _, err := root.FindAll(queryStr); !errors.Is(err, ErrInvalidNumber) {
+			t.Errorf("%s: got %v, want %v", queryStr, err, ErrInvalidNumber)
+		}
+	}
+	if _, err := root.FindAll(`li[@content<>"5"]`); err != ErrInvalidRange {
+		t.Errorf("got %v, want %v", err, ErrInvalidRange)
+	}
+	lis, _ := root.FindAll(`li`)
+	e, err := Explain(root, `li[@content>"100"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if why := e.Why(lis[3]); len(why) != 1 || !strings.HasSuffix(why[0], `(no number in value)`) {
+		t.Errorf("got %q", why)
+	}
+	if why := e.Why(lis[0]); len(why) != 1 || !strings.HasSuffix(why[0], `rejected by @content>"100"`) {
+		t.Errorf("got %q", why)
+	}
+	e, _ = Explain(root, `li[date>="2024-01-01"]`)
+	if why := e.Why(lis[3]); len(why) != 1 || !strings.HasSuffix(why[0], `(no value)`) {
+		t.Errorf("got %q", why)
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	for s, want := range map[string]float64{
+		"1.234":     1.234,
+		"1,234":     1234,
+		"1,5":       1.5,
+		"1,2345":    1.2345,
+		"1.234.567": 1234567,
+		"1,234,567": 1234567,
+		"1,234.5":   1234.5,
+		"1.234,5":   1234.5,
+		"1'234.5":   1234.5,
+		"\u22125":   -5,
+	} {
+		if v, ok := parseNumber(s); !ok || v != want {
+			t.Errorf("%q: got %v %v, want %v", s, v, ok, want)
+		}
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	root, err := Parse([]byte(`<div>
+<a title='He said "hi"'>quote</a>
+<a title="it's [x]">bracket</a>
+<a title="back\slash" data-id="7">slash</a>
+</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `a[title="He said \"hi\""]`, "a:quote")
+	checkFindAll(t, root, `a[title='He said "hi"']`, "a:quote")
+	checkFindAll(t, root, `a[title='it\'s [x]']`, "a:bracket")
+	checkFindAll(t, root, `a[title="it's [x]"] ~ a`, "a:slash")
+	checkFindAll(t, root, `a[title="back\\slash"]`, "a:slash")
+	checkFindAll(t, root, `a[title=r"back\slash"]`, "a:slash")
+	checkFindAll(t, root, `a[title%=r'\[\w\]']`, "a:bracket")
+	checkFindAll(t, root, `a[data-id="7"]`, "a:slash")
+	for queryStr, want := range map[string]error{
+		`a[title="hi]`:      ErrUnterminatedString,
+		`a[title=hi]`:       ErrInvalidCharacter,
+		`a[="hi"]`:          ErrInvalidAttrName,
+		`a[title "hi"]`:     ErrInvalidOperator,
+		`a[title="hi" "x"]`: ErrInvalidCharacter,
+		`a[title="hi"`:      ErrInvalidCharacter,
+		`a#b`:               ErrInvalidCharacter,
+	} {
+		if _, err := root.FindAll(queryStr); err != want {
+			t.Errorf("%s: got %v, want %v", queryStr, err, want)
+		}
+	}
+}
+
+func TestUnionQuery(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `span, li[class="x"], ul`, "ul:one two three", "li:two", "span:inner")
+	checkFindAll(t, root, `p, div p, div[id="app"] > p`, "p:para inner", "p:deep")
+	checkFindAll(t, root, `div:has(span, li[class="y"])`, "div:one two three para inner deep")
+	for _, queryStr := range []string{`p,`, `, p`, `p,,li`} {
+		if _, err := root.FindAll(queryStr); err != ErrNoValidQuery {
+			t.Errorf("%s: got %v, want %v", queryStr, err, ErrNoValidQuery)
+		}
+	}
+}
+
+func TestNameQuery(t *testing.T) {
+	root, err := Parse([]byte(`<div>
+<h1>a</h1><h2>b</h2><hr><h3 class="x">c</h3>
+<x-card>d</x-card><x-badge>e</x-badge>
+<table><tr><th>f</th><td class="x">g</td><td>h</td></tr></table>
+</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `div > h*`, "h1:a", "h2:b", "hr:", "h3:c")
+	checkFindAll(t, root, `h1|h2|h3[class="x"]`, "h3:c")
+	checkFindAll(t, root, `x-*`, "x-card:d", "x-badge:e")
+	checkFindAll(t, root, `tr > th|td`, "th:f", "td:g", "td:h")
+	checkFindAll(t, root, `div > *[class="x"]`, "h3:c")
+	checkFindAll(t, root, `tr > *:last`, "td:h")
+	if _, err := root.FindAll(`th|`); err != ErrInvalidCharacter {
+		t.Errorf("got %v, want %v", err, ErrInvalidCharacter)
+	}
+}
+
+// registerFunc registers f for the test and removes it when the test ends.
+func registerFunc(t *testing.T, name string, f PredicateFunc) {
+	t.Helper()
+	if err := RegisterFunc(name, f); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UnregisterFunc(name) })
+}
+
+func TestFuncQuery(t *testing.T) {
+	root, err := Parse([]byte(`<div>
+<a href="/about">about</a>
+<a href="https://example.com/x">example</a>
+<a href="/contact" class="nav">contact</a>
+</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal := func(n *Node, args ...string) bool {
+		return strings.HasPrefix(n.AttrMap["href"], "/")
+	}
+	prefix := func(n *Node, args ...string) bool {
+		for _, arg := range args {
+			if strings.HasPrefix(n.Content, arg) {
+				return true
+			}
+		}
+		return false
+	}
+	registerFunc(t, "funcquery-internal", internal)
+	registerFunc(t, "funcquery-prefix", prefix)
+	checkFindAll(t, root, `a[:funcquery-internal]`, "a:about", "a:contact")
+	checkFindAll(t, root, `a[!:funcquery-internal()]`, "a:example")
+	checkFindAll(t, root, `a[:funcquery-internal() & class="nav"]`, "a:contact")
+	checkFindAll(t, root, `a[:funcquery-prefix("ex", "ab") | class="nav"]`, "a:about", "a:example", "a:contact")
+	sel := MustCompile(`a[:funcquery-prefix("c")]`)
+	registerFunc(t, "funcquery-prefix", func(n *Node, args ...string) bool { return false })
+	if nodes := sel.FindAll(root); len(nodes) != 1 || !sel.Match(nodes[0]) {
+		t.Errorf("compiled query: got %d nodes, want 1", len(nodes))
+	}
+	UnregisterFunc("funcquery-prefix")
+	if _, err := root.FindAll(`a[:funcquery-prefix("c")]`); !errors.Is(err, ErrUnknownFunc) {
+		t.Errorf("got %v, want %v", err, ErrUnknownFunc)
+	}
+	if nodes := sel.FindAll(root); len(nodes) != 1 {
+		t.Errorf("compiled query after unregister: got %d nodes, want 1", len(nodes))
+	}
+	if _, err := root.FindAll(`a[:missing()]`); !errors.Is(err, ErrUnknownFunc) {
+		t.Errorf("got %v, want %v", err, ErrUnknownFunc)
+	}
+	if err := RegisterFunc("@text", internal); err != ErrInvalidFuncName {
+		t.Errorf("got %v, want %v", err, ErrInvalidFuncName)
+	}
+}
+
+func TestFindValues(t *testing.T) {
+	root, err := Parse([]byte(`<div>
+<a class="x" href="/a">first <b>link</b></a>
+<a class="x">no href</a>
+<img src="1.png"><img src="2.png">
+<meta content="meta value">
+</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for queryStr, want := range map[string][]string{
+		`a[class="x"]/@href`:                 {"/a"},
+		`a/text()`:                           {"first  link", "no href"},
+		`a / owntext()`:                      {"first", "no href"},
+		`img/@src`:                           {"1.png", "2.png"},
+		`a:first/html()`:                     {"first <b>link</b>"},
+		`meta/@content`:                      {"meta value"},
+		`b/name(), img:nth-of-type(-1)/@src`: {"b", "2.png"},
+		`div > a:nth-of-type(2)/content()`:   {"no href"},
+		`a[class="y"]/@href`:                 nil,
+	} {
+		got, err := root.FindValues(queryStr)
+		if err != nil {
+			t.Fatalf("%s: %v", queryStr, err)
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") || len(got) != len(want) {
+			t.Errorf("%s: got %q, want %q", queryStr, got, want)
+		}
+	}
+	for queryStr, want := range map[string]error{
+		`a`:            ErrNoProjection,
+		`a/@href, img`: ErrNoProjection,
+		`a/src()`:      ErrInvalidProjection,
+		`a/@`:          ErrInvalidProjection,
+		`a:has(b/@x)`:  ErrInvalidProjection,
+		`a/@href > b`:  ErrInvalidCharacter,
+	} {
+		if _, err := root.FindValues(queryStr); err != want {
+			t.Errorf("%s: got %v, want %v", queryStr, err, want)
+		}
+	}
+	if nodes, _ := root.FindAll(`a/@href`); len(nodes) != 2 {
+		t.Errorf("FindAll with projection: got %d nodes, want 2", len(nodes))
+	}
+}
+
+func TestFindMatches(t *testing.T) {
+	root, err := Parse([]byte(`<ul>
+<li id="item-12">2019 KTM 640, $5,200</li>
+<li id="item-13">no year</li>
+<li id="item-14">2021 Honda XR650, $7,100</li>
+</ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := root.FindMatches(`li[@content%="(?P<year>\d{4}) (\w+)" & id%=r"item-(\d+)"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(matches))
+	}
+	m := matches[1]
+	if m.Node.AttrMap["id"] != "item-14" || m.Named["year"] != "2021" {
+		t.Errorf("unexpected match: %+v", m)
+	}
+	if len(m.Submatches) != 2 || m.Submatches[0][2] != "Honda" || m.Submatches[1][1] != "14" {
+		t.Errorf("unexpected submatches: %q", m.Submatches)
+	}
+	matches, _ = root.FindMatches(`li[id="item-13" | @content%="\$(?P<price>[\d,]+)"]`)
+	if len(matches) != 3 || len(matches[1].Submatches) != 0 || matches[2].Named["price"] != "7,100" {
+		t.Errorf("unexpected matches: %+v", matches)
+	}
+	matches, _ = root.FindMatches(`li[id="item-13" & @content%="(?P<year>\d{4})" | id%="item-(?P<n>\d+)"]`)
+	if m := matches[0]; len(matches) != 3 || len(m.Submatches) != 1 || m.Named["year"] != "" || m.Named["n"] != "12" {
+		t.Errorf("unexpected matches: %+v", matches)
+	}
+}
+
+func TestFuzzyQuery(t *testing.T) {
+	root, err := Parse([]byte(`<table>
+<tr><td>Make/Model</td><td>KTM 640</td></tr>
+<tr><td>Make &amp; Model</td><td>Honda XR</td></tr>
+<tr><td>Makes Model:</td><td>Yamaha</td></tr>
+<tr><td>Model Year</td><td>2019</td></tr>
+</table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFindAll(t, root, `td[@content~~="Make Model"]`, "td:Make/Model", "td:Make & Model", "td:Makes Model:")
+	checkFindAll(t, root, `td[@content~~="Make Model" 0.3]`, "td:Make/Model", "td:Make & Model", "td:Makes Model:", "td:Model Year")
+	checkFindAll(t, root, `td[@content~~="make model" 1] + td`, "td:KTM 640", "td:Honda XR")
+	best, err := root.FindBest(`td[@content~~="Make Model" 0.3]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(best) != 4 || best[0].Score != 1 || best[1].Score != 1 || best[2].Node.Content != "Makes Model:" || best[3].Score >= best[2].Score {
+		t.Errorf("unexpected ranking: %+v", best)
+	}
+	if _, err := root.FindAll(`td[@content~~="x" 1.5]`); err != ErrInvalidThreshold {
+		t.Errorf("got %v, want %v", err, ErrInvalidThreshold)
+	}
+}
+
+func TestFindAllArgs(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := root.FindAllArgs(`li[@content=$label | class=?]`, map[string]string{"label": "one", "1": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(nodes); len(got) != 2 || got[0] != "li:one" || got[1] != "li:two" {
+		t.Fatalf("got %q", got)
+	}
+	nodes, err = root.FindAllArgs(`li[@content=?]`, map[string]string{"1": `one"] | li[class="x`})
+	if err != nil || len(nodes) != 0 {
+		t.Fatalf("got %q, %v", names(nodes), err)
+	}
+	nodes, err = root.FindAllArgs(`li[@content%=$re]`, map[string]string{"re": "^" + QuoteRegexp("t.o") + "$"})
+	if err != nil || len(nodes) != 0 {
+		t.Fatalf("got %q, %v", names(nodes), err)
+	}
+	literal, err := Parse([]byte(`<ul><li>a.b*(c)\d</li><li>axbbbc7</li><li>a-c1</li><li>x a.b*(c)\d y</li></ul>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err = literal.FindAllArgs(`li[@content%=$re]`, map[string]string{"re": QuoteRegexp(`a.b*(c)\d`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(nodes); len(got) != 2 || got[0] != `li:a.b*(c)\d` || got[1] != `li:x a.b*(c)\d y` {
+		t.Fatalf("got %q", got)
+	}
+	nodes, err = literal.FindAllArgs(`li[@content%=$re]`, map[string]string{"re": "^" + QuoteRegexp(`a.b*(c)\d`) + "$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(nodes); len(got) != 1 || got[0] != `li:a.b*(c)\d` {
+		t.Fatalf("got %q", got)
+	}
+	if _, err := root.FindAllArgs(`li[@content=$label]`, nil); !errors.Is(err, ErrUnboundPlaceholder) {
+		t.Fatalf("got %v", err)
+	}
+	sel, err := CompileArgs(`p:has(span[@content=$s])`, map[string]string{"s": `in"ner`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := sel.String(); s != `p:has(span[@content="in\"ner"])` {
+		t.Fatalf("got %s", s)
+	}
+}
+
+func TestIterQuery(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := root.Iter(`li, p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for n := range seq {
+		got = append(got, n.Name+":"+n.GetAllContent())
+		if len(got) == 2 {
+			break
+		}
+	}
+	if len(got) != 2 || got[0] != "li:one" || got[1] != "li:two" {
+		t.Fatalf("got %q", got)
+	}
+	seq, _ = root.Iter(`p:has(span)`)
+	got = got[:0]
+	for n := range seq {
+		got = append(got, n.Name)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %q", got)
+	}
+	n, err := root.FindFirst(`div p`)
+	if err != nil || n == nil || n.GetAllContent() != "para inner" {
+		t.Fatalf("got %v, %v", n, err)
+	}
+	if n, _ := root.FindFirst(`table`); n != nil {
+		t.Fatalf("got %v", n)
+	}
+}
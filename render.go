@@ -0,0 +1,40 @@
+package nbsoup
+
+import (
+	"html"
+	"strings"
+)
+
+func (n *Node) innerHTML() string {
+	var b strings.Builder
+	n.writeInner(&b)
+	return b.String()
+}
+
+func (n *Node) writeInner(b *strings.Builder) {
+	b.WriteString(html.EscapeString(n.Content))
+	for _, child := range n.Children {
+		child.writeOuter(b)
+	}
+}
+
+func (n *Node) writeOuter(b *strings.Builder) {
+	if n.Name == "" {
+		n.writeInner(b)
+		return
+	}
+	n.writeStartTag(b)
+	if voidTags[n.Name] {
+		return
+	}
+	n.writeInner(b)
+	b.WriteString("</" + n.Name + ">")
+}
+
+func (n *Node) writeStartTag(b *strings.Builder) {
+	b.WriteString("<" + n.Name)
+	for _, k := range sortedKeys(n.AttrMap) {
+		b.WriteString(" " + k + `="` + html.EscapeString(n.AttrMap[k]) + `"`)
+	}
+	b.WriteString(">")
+}
@@ -0,0 +1,226 @@
+package nbsoup
+
+import (
+	"slices"
+	"strings"
+)
+
+// Selection is a list of element nodes in document order without
+// duplicates. Methods taking a query keep the first error, Err returns it and
+// every later method returns an empty selection with the same error.
+type Selection struct {
+	Nodes []*Node
+	err   error
+}
+
+// Find returns a selection of the nodes matched by the query under n.
+func (n *Node) Find(queryStr string) *Selection {
+	nodes, err := n.FindAll(queryStr)
+	return newSelection(nodes, err)
+}
+
+func newSelection(nodes []*Node, err error) *Selection {
+	if err != nil {
+		return &Selection{err: err}
+	}
+	seen := make(map[*Node]bool, len(nodes))
+	l := make([]*Node, 0, len(nodes))
+	for _, n := range nodes {
+		if n != nil && n.Name != "" && !seen[n] {
+			seen[n] = true
+			l = append(l, n)
+		}
+	}
+	if len(l) > 1 {
+		sortDocumentOrder(l)
+	}
+	return &Selection{Nodes: l}
+}
+
+// sortDocumentOrder sorts nodes by their position in their documents, the
+// documents in the order their first node appears in l.
+func sortDocumentOrder(l []*Node) {
+	type position struct {
+		node *Node
+		doc  int
+		path []int
+	}
+	docs := make(map[*Node]int)
+	childIndex := make(map[*Node]int)
+	positions := make([]position, 0, len(l))
+	for _, n := range l {
+		var path []int
+		for p := n; p.Parent != nil; p = p.Parent {
+			if _, ok := childIndex[p]; !ok {
+				for i, child := range p.Parent.Children {
+					childIndex[child] = i
+				}
+			}
+			path = append(path, childIndex[p])
+		}
+		slices.Reverse(path)
+		root := n.Root()
+		if _, ok := docs[root]; !ok {
+			docs[root] = len(docs)
+		}
+		positions = append(positions, position{n, docs[root], path})
+	}
+	slices.SortStableFunc(positions, func(a, b position) int {
+		if a.doc != b.doc {
+			return a.doc - b.doc
+		}
+		return slices.Compare(a.path, b.path)
+	})
+	for i, p := range positions {
+		l[i] = p.node
+	}
+}
+
+func (s *Selection) Err() error {
+	return s.err
+}
+
+// each builds a new selection from the nodes f returns for every node of s.
+func (s *Selection) each(f func(n *Node) []*Node) *Selection {
+	if s.err != nil {
+		return s
+	}
+	var nodes []*Node
+	for _, n := range s.Nodes {
+		nodes = append(nodes, f(n)...)
+	}
+	return newSelection(nodes, nil)
+}
+
+func (s *Selection) compile(queryStr string) (*Selector, *Selection) {
+	if s.err != nil {
+		return nil, s
+	}
+	sel, err := Compile(queryStr)
+	if err != nil {
+		return nil, &Selection{err: err}
+	}
+	return sel, nil
+}
+
+// Find returns the nodes matched by the query under any node of s.
+func (s *Selection) Find(queryStr string) *Selection {
+	sel, failed := s.compile(queryStr)
+	if failed != nil {
+		return failed
+	}
+	return s.each(sel.FindAll)
+}
+
+// Filter keeps the nodes matched by the query, with the whole document as the
+// start node.
+func (s *Selection) Filter(queryStr string) *Selection {
+	return s.filter(queryStr, true)
+}
+
+// Not drops the nodes matched by the query.
+func (s *Selection) Not(queryStr string) *Selection {
+	return s.filter(queryStr, false)
+}
+
+func (s *Selection) filter(queryStr string, keep bool) *Selection {
+	sel, failed := s.compile(queryStr)
+	if failed != nil {
+		return failed
+	}
+	return s.each(func(n *Node) []*Node {
+		if sel.Match(n) == keep {
+			return []*Node{n}
+		}
+		return nil
+	})
+}
+
+func (s *Selection) Parent() *Selection {
+	return s.each(func(n *Node) []*Node {
+		return []*Node{n.Parent}
+	})
+}
+
+// Closest returns for every node the node itself or its nearest ancestor
+// matched by the query.
+func (s *Selection) Closest(queryStr string) *Selection {
+	sel, failed := s.compile(queryStr)
+	if failed != nil {
+		return failed
+	}
+	return s.each(func(n *Node) []*Node {
+		return []*Node{sel.Closest(n)}
+	})
+}
+
+func (s *Selection) Children() *Selection {
+	return s.each(func(n *Node) []*Node {
+		return n.Children
+	})
+}
+
+// Siblings returns the element siblings of every node, without the node
+// itself unless it is the sibling of another node of s.
+func (s *Selection) Siblings() *Selection {
+	return s.each(func(n *Node) []*Node {
+		return append(slices.Collect(n.PrevSiblings()), slices.Collect(n.NextSiblings())...)
+	})
+}
+
+func (s *Selection) First() *Selection {
+	return s.Eq(0)
+}
+
+func (s *Selection) Last() *Selection {
+	return s.Eq(-1)
+}
+
+// Eq returns the i-th node, counting from the end if i is negative.
+func (s *Selection) Eq(i int) *Selection {
+	if s.err != nil {
+		return s
+	}
+	if i < 0 {
+		i += len(s.Nodes)
+	}
+	if i < 0 || i >= len(s.Nodes) {
+		return &Selection{}
+	}
+	return &Selection{Nodes: []*Node{s.Nodes[i]}}
+}
+
+func (s *Selection) Each(f func(i int, n *Node)) *Selection {
+	for i, n := range s.Nodes {
+		f(i, n)
+	}
+	return s
+}
+
+func (s *Selection) Map(f func(i int, n *Node) string) []string {
+	l := make([]string, 0, len(s.Nodes))
+	for i, n := range s.Nodes {
+		l = append(l, f(i, n))
+	}
+	return l
+}
+
+// Text joins the GetAllContent of the nodes with a space.
+func (s *Selection) Text() string {
+	return strings.Join(s.Map(func(_ int, n *Node) string {
+		return n.GetAllContent()
+	}), " ")
+}
+
+// Attr returns the attribute of the first node, pseudo attributes like
+// @content work as well.
+func (s *Selection) Attr(name string) (string, bool) {
+	if len(s.Nodes) == 0 {
+		return "", false
+	}
+	return s.Nodes[0].attrValue(name)
+}
+
+func (s *Selection) Len() int {
+	return len(s.Nodes)
+}
@@ -0,0 +1,81 @@
+package nbsoup
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelection(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(s *Selection, want ...string) {
+		t.Helper()
+		if s.Err() != nil {
+			t.Fatal(s.Err())
+		}
+		got := names(s.Nodes)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+	li := root.Find(`li`)
+	check(li, "li:one", "li:two", "li:three")
+	check(root.Find(`div`).Find(`p`), "p:para inner", "p:deep")
+	check(li.Filter(`[class="x"]`), "li:two")
+	check(li.Not(`[class="x"]`), "li:one", "li:three")
+	check(li.Parent(), "ul:one two three")
+	check(root.Find(`span, p`).Closest(`div`), "div:one two three para inner deep", "div:deep")
+	check(root.Find(`ul`).Children().Last(), "li:three")
+	check(li.Eq(1).Siblings(), "li:one", "li:three")
+	check(li.First().Siblings().Eq(-1), "li:three")
+	check(li.Eq(5))
+	if li.Len() != 3 || li.Text() != "one two three" {
+		t.Fatalf("got %d, %q", li.Len(), li.Text())
+	}
+	if v, ok := li.Eq(1).Attr("class"); !ok || v != "x" {
+		t.Fatalf("got %q", v)
+	}
+	got := li.Map(func(i int, n *Node) string { return n.Content })
+	if strings.Join(got, ",") != "one,two,three" {
+		t.Fatalf("got %q", got)
+	}
+	var count int
+	li.Each(func(i int, n *Node) { count++ })
+	if count != 3 {
+		t.Fatalf("got %d", count)
+	}
+	if s := root.Find(`li[`).Children(); s.Err() == nil || s.Len() != 0 {
+		t.Fatalf("got %v", s.Err())
+	}
+}
+
+func TestSelectionOrder(t *testing.T) {
+	a, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Parse([]byte(`<p>other</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []*Node
+	for _, root := range []*Node{a, b} {
+		for n := range root.Descendants() {
+			if n.Name == "li" || n.Name == "p" {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	slices.Reverse(nodes)
+	s := newSelection(append(nodes, nodes[1]), nil)
+	want := []string{"p:other", "li:one", "li:two", "li:three", "p:para inner", "p:deep"}
+	if got := names(s.Nodes); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if a.index != nil || b.index != nil {
+		t.Fatal("ordering a selection built the document index")
+	}
+}
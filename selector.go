@@ -0,0 +1,119 @@
+package nbsoup
+
+import (
+	"iter"
+	"slices"
+)
+
+// Selector is a parsed query which can be run many times without parsing the
+// query string again.
+type Selector struct {
+	source string
+	union  union
+}
+
+func Compile(queryStr string) (*Selector, error) {
+	u, err := parseUnion(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	return &Selector{source: u.String(), union: u}, nil
+}
+
+// CompileArgs is the same as Compile but binds the placeholders of the query,
+// $name to args["name"] and the n-th ? to args["n"] counting from 1.
+func CompileArgs(queryStr string, args map[string]string) (*Selector, error) {
+	u, err := parseUnionArgs(queryStr, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Selector{source: u.String(), union: u}, nil
+}
+
+func MustCompile(queryStr string) *Selector {
+	sel, err := Compile(queryStr)
+	if err != nil {
+		panic(`nbsoup: Compile(` + queryStr + `): ` + err.Error())
+	}
+	return sel
+}
+
+// FindAll is the same as Node.FindAll with a compiled query.
+func (s *Selector) FindAll(n *Node) []*Node {
+	var nodes []*Node
+	if candidates, ok := s.candidates(n); ok {
+		for _, node := range candidates {
+			if s.union.match(node, n) {
+				nodes = append(nodes, node)
+			}
+		}
+		return nodes
+	}
+	n.walkDescendants(func(node *Node) bool {
+		if s.union.match(node, n) {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+// Iter is the same as Node.Iter with a compiled query.
+func (s *Selector) Iter(n *Node) iter.Seq[*Node] {
+	if candidates, ok := s.candidates(n); ok {
+		return s.filter(n, slices.Values(candidates))
+	}
+	return s.filter(n, n.descendants())
+}
+
+// FindFirst is the same as Node.FindFirst with a compiled query.
+func (s *Selector) FindFirst(n *Node) *Node {
+	for node := range s.Iter(n) {
+		return node
+	}
+	return nil
+}
+
+func (s *Selector) filter(root *Node, input iter.Seq[*Node]) iter.Seq[*Node] {
+	return func(yield func(*Node) bool) {
+		for node := range input {
+			if s.union.match(node, root) && !yield(node) {
+				return
+			}
+		}
+	}
+}
+
+// FindValues is the same as Node.FindValues with a compiled query.
+func (s *Selector) FindValues(n *Node) ([]string, error) {
+	for _, query := range s.union {
+		if query.Projection == "" {
+			return nil, ErrNoProjection
+		}
+	}
+	var values []string
+	for node := range s.Iter(n) {
+		for _, query := range s.union {
+			if !node.matchChain(query, n) {
+				continue
+			}
+			if value, ok := node.attrValue(query.Projection); ok {
+				values = append(values, value)
+			}
+			break
+		}
+	}
+	return values, nil
+}
+
+// Match reports whether n matches the query, with the whole document as the
+// start node.
+func (s *Selector) Match(n *Node) bool {
+	return s.union.match(n, n.Root())
+}
+
+// String returns the canonical query string, the same for every way the
+// selector was made.
+func (s *Selector) String() string {
+	return s.source
+}
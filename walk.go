@@ -0,0 +1,71 @@
+package nbsoup
+
+// WalkAction tells Walk how to go on after a Visitor callback.
+type WalkAction int
+
+const (
+	WalkContinue WalkAction = iota
+	// WalkSkip returned by Enter skips the children of the node, its Leave is
+	// still called. Returned by Leave it is the same as WalkContinue.
+	WalkSkip
+	WalkStop
+)
+
+// Step is the position of a visited node. Path holds the index in the
+// Children of its parent of every node from the start node down to Node, so
+// len(Path) == Depth and the start node has an empty path. Path is reused
+// during the walk, copy it to keep it.
+type Step struct {
+	Node  *Node
+	Depth int
+	Path  []int
+}
+
+// Visitor is called by Walk when it enters a node, before the children, and
+// when it leaves it, after the children.
+type Visitor interface {
+	Enter(s Step) WalkAction
+	Leave(s Step) WalkAction
+}
+
+// VisitorFuncs is a Visitor made of two functions, a nil function continues.
+type VisitorFuncs struct {
+	EnterFunc func(s Step) WalkAction
+	LeaveFunc func(s Step) WalkAction
+}
+
+func (v VisitorFuncs) Enter(s Step) WalkAction {
+	if v.EnterFunc == nil {
+		return WalkContinue
+	}
+	return v.EnterFunc(s)
+}
+
+func (v VisitorFuncs) Leave(s Step) WalkAction {
+	if v.LeaveFunc == nil {
+		return WalkContinue
+	}
+	return v.LeaveFunc(s)
+}
+
+// Walk visits n and all nodes under it in document order, nodes without a
+// name like comments included.
+func Walk(n *Node, v Visitor) {
+	walk(n, v, make([]int, 0, 16))
+}
+
+func walk(n *Node, v Visitor, path []int) bool {
+	step := Step{n, len(path), path}
+	switch v.Enter(step) {
+	case WalkStop:
+		return false
+	case WalkSkip:
+	default:
+		for i, child := range n.Children {
+			if !walk(child, v, append(path, i)) {
+				return false
+			}
+		}
+	}
+	return v.Leave(step) != WalkStop
+}
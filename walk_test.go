@@ -0,0 +1,50 @@
+package nbsoup
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	root, err := Parse(queryTestHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, _ := root.FindFirst(`div[id="app"]`)
+	var events []string
+	var paths [][]int
+	Walk(app, VisitorFuncs{
+		EnterFunc: func(s Step) WalkAction {
+			events = append(events, fmt.Sprintf("+%s%d", s.Node.Name, s.Depth))
+			paths = append(paths, slices.Clone(s.Path))
+			if s.Node.Name == "ul" {
+				return WalkSkip
+			}
+			return WalkContinue
+		},
+		LeaveFunc: func(s Step) WalkAction {
+			events = append(events, "-"+s.Node.Name)
+			if s.Node.Name == "p" && s.Depth == 2 {
+				return WalkStop
+			}
+			return WalkContinue
+		},
+	})
+	want := "+div0 +ul1 -ul +p1 +span2 -span -p +div1 +p2 -p"
+	if got := strings.Join(events, " "); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if fmt.Sprint(paths) != "[[] [0] [1] [1 0] [2] [2 0]]" {
+		t.Fatalf("got %v", paths)
+	}
+	histogram := make(map[string]int)
+	Walk(root, VisitorFuncs{EnterFunc: func(s Step) WalkAction {
+		histogram[s.Node.Name]++
+		return WalkContinue
+	}})
+	if histogram["li"] != 3 || histogram["p"] != 2 {
+		t.Fatalf("got %v", histogram)
+	}
+}